@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+// APIKeyPrefix marks the keys issued by the API so they are easy to spot in logs and secret scanners
+const APIKeyPrefix = "qsk_"
+
+// APIKeyScopes are the permissions that can be granted to an API key,
+// user management is left out so a leaked key can't escalate its own access
+var APIKeyScopes = []shared.Permission{
+	shared.PermProductsRead, shared.PermProductsWrite, shared.PermProductsDelete,
+	shared.PermCategoriesRead, shared.PermCategoriesWrite, shared.PermCategoriesDelete,
+	shared.PermHistoryRead,
+}
+
+// Scopes are the permissions of an API key stored as a JSON array
+type Scopes []shared.Permission
+
+func (s Scopes) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+func (s *Scopes) Scan(value any) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case nil:
+		*s = nil
+		return nil
+	}
+	return errors.New("unsupported scopes value")
+}
+
+func (Scopes) GormDataType() string {
+	return "jsonb"
+}
+
+// APIKey authenticates machine to machine integrations, only the hash of the key is stored
+type APIKey struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Name        string     `gorm:"not null" json:"name"`
+	Prefix      string     `gorm:"not null" json:"prefix"`
+	KeyHash     string     `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes      Scopes     `gorm:"type:jsonb;not null" json:"scopes"`
+	CreatedByID uint       `gorm:"index" json:"created_by_id"`
+	TenantID    *uint      `gorm:"index" json:"tenant_id"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `gorm:"index" json:"revoked_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+func validScope(scope shared.Permission) bool {
+	return slices.Contains(APIKeyScopes, scope)
+}
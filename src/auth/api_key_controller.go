@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type APIKeyController struct {
+	service   *APIKeyService
+	validator *shared.XValidator
+}
+
+func NewAPIKeyController(service *APIKeyService, validator *shared.XValidator) *APIKeyController {
+	return &APIKeyController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// Routes declares the api key endpoints and the permission each one requires
+func (kc *APIKeyController) Routes() []shared.Route {
+	return []shared.Route{
+		{Method: fiber.MethodGet, Path: "/api/v1/api-keys", Handler: kc.GetAPIKeys, Permission: shared.PermAPIKeysManage},
+		{Method: fiber.MethodPost, Path: "/api/v1/api-keys", Handler: kc.CreateAPIKey, Permission: shared.PermAPIKeysManage},
+		{Method: fiber.MethodPost, Path: "/api/v1/api-keys/:id/rotate", Handler: kc.RotateAPIKey, Permission: shared.PermAPIKeysManage},
+		{Method: fiber.MethodDelete, Path: "/api/v1/api-keys/:id", Handler: kc.RevokeAPIKey, Permission: shared.PermAPIKeysManage},
+	}
+}
+
+func (kc *APIKeyController) RegisterRoutes(app *fiber.App, guard shared.RouteGuard) {
+	shared.RegisterRoutes(app, guard, kc.Routes())
+}
+
+// @Summary Get API keys
+// @Description Get every API key including the revoked and expired ones, the secrets are never returned
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} shared.Response{data=[]APIKey} "OK with API keys"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /api-keys [get]
+func (kc *APIKeyController) GetAPIKeys(c fiber.Ctx) error {
+	principal, _ := shared.PrincipalFrom(c)
+	keys, err := kc.service.FindAll(principal)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch api keys")
+	}
+	return shared.NewSuccessResponse(c, fiber.StatusOK, keys)
+}
+
+// @Summary Create an API key
+// @Description Create a scoped API key for machine to machine integrations, use it as "Authorization: ApiKey <key>". The key is only returned once
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param key body CreateAPIKeyDTO true "API key data, scopes are permissions like products:read"
+// @Success 201 {object} shared.Response{data=IssuedAPIKeyDTO} "API key created successfully"
+// @Failure 400 {object} shared.Response "Invalid request body, scope or expiry"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden or tenant not allowed"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /api-keys [post]
+func (kc *APIKeyController) CreateAPIKey(c fiber.Ctx) error {
+	var dto CreateAPIKeyDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if errs := kc.validator.Validate(dto); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	principal, _ := shared.PrincipalFrom(c)
+	key, err := kc.service.Create(&dto, principal)
+	if err != nil {
+		if errors.Is(err, shared.ErrTenantMismatch) {
+			return shared.NewErrorResponse(c, fiber.StatusForbidden, "Forbidden: tenant not allowed")
+		}
+		if errors.Is(err, ErrInvalidScope) || errors.Is(err, ErrInvalidExpiry) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to create api key")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusCreated, key)
+}
+
+// @Summary Rotate an API key
+// @Description Issue a new secret for the API key, the previous one stops working immediately
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} shared.Response{data=IssuedAPIKeyDTO} "API key rotated successfully"
+// @Failure 400 {object} shared.Response "Invalid API key ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "API key not found"
+// @Failure 409 {object} shared.Response "API key revoked"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /api-keys/{id}/rotate [post]
+func (kc *APIKeyController) RotateAPIKey(c fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid api key ID")
+	}
+
+	principal, _ := shared.PrincipalFrom(c)
+	key, err := kc.service.Rotate(principal, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Api key not found")
+		}
+		if errors.Is(err, ErrAPIKeyRevoked) {
+			return shared.NewErrorResponse(c, fiber.StatusConflict, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to rotate api key")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, key)
+}
+
+// @Summary Revoke an API key
+// @Description Revoke the API key, it can't be used nor rotated anymore
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} shared.Response "API key revoked successfully"
+// @Failure 400 {object} shared.Response "Invalid API key ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "API key not found"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /api-keys/{id} [delete]
+func (kc *APIKeyController) RevokeAPIKey(c fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid api key ID")
+	}
+
+	principal, _ := shared.PrincipalFrom(c)
+	if err := kc.service.Revoke(principal, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Api key not found")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to revoke api key")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, "Api key revoked successfully")
+}
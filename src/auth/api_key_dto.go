@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+type CreateAPIKeyDTO struct {
+	Name      string              `json:"name" validate:"required"`
+	Scopes    []shared.Permission `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time          `json:"expires_at"`
+	// TenantID binds the key to a tenant, keys created by admins bound to a tenant are bound to it
+	TenantID *uint `json:"tenant_id"`
+}
+
+// IssuedAPIKeyDTO is returned once when a key is created or rotated, the key can't be read again
+type IssuedAPIKeyDTO struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository struct {
+	DB *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{DB: db}
+}
+
+func (r *APIKeyRepository) Create(key *APIKey) error {
+	return r.DB.Create(key).Error
+}
+
+// FindAll returns the keys, only the ones of the tenant when tenantID is set
+func (r *APIKeyRepository) FindAll(tenantID *uint) ([]APIKey, error) {
+	var keys []APIKey
+	query := r.DB.Order("id")
+	if tenantID != nil {
+		query = query.Where("tenant_id = ?", *tenantID)
+	}
+	err := query.Find(&keys).Error
+	return keys, err
+}
+
+func (r *APIKeyRepository) FindByID(id uint) (*APIKey, error) {
+	var key APIKey
+	if err := r.DB.First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) FindByHash(hash string) (*APIKey, error) {
+	var key APIKey
+	if err := r.DB.Where("key_hash = ?", hash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Rotate replaces the hash of an active key so the previous secret stops working at once
+func (r *APIKeyRepository) Rotate(key *APIKey) error {
+	result := r.DB.Model(key).
+		Where("revoked_at IS NULL").
+		Updates(map[string]any{"key_hash": key.KeyHash, "prefix": key.Prefix, "last_used_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) Revoke(id uint, now time.Time) error {
+	return r.DB.Model(&APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", now).Error
+}
+
+// TouchLastUsed records the use of the key at most once per interval to avoid a write on every request
+func (r *APIKeyRepository) TouchLastUsed(id uint, now time.Time, interval time.Duration) error {
+	return r.DB.Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-interval)).
+		UpdateColumn("last_used_at", now).Error
+}
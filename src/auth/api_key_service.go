@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
+)
+
+const lastUsedInterval = time.Minute
+
+var (
+	ErrInvalidScope  = errors.New("invalid scope")
+	ErrInvalidExpiry = errors.New("expires_at must be in the future")
+	ErrAPIKeyRevoked = errors.New("api key has been revoked")
+)
+
+type APIKeyService struct {
+	repo *APIKeyRepository
+	now  func() time.Time
+}
+
+func NewAPIKeyService(repo *APIKeyRepository) *APIKeyService {
+	return &APIKeyService{repo: repo, now: time.Now}
+}
+
+// FindAll lists the keys visible to the admin, the admins bound to a tenant only see the keys of their tenant
+func (s *APIKeyService) FindAll(admin *shared.Principal) ([]APIKey, error) {
+	return s.repo.FindAll(admin.TenantID)
+}
+
+// find returns the key when it is visible to the admin
+func (s *APIKeyService) find(admin *shared.Principal, id uint) (*APIKey, error) {
+	key, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if admin.TenantID != nil && (key.TenantID == nil || *key.TenantID != *admin.TenantID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return key, nil
+}
+
+// Create issues a new key for the creator, the returned key is the only time the secret is available
+func (s *APIKeyService) Create(dto *CreateAPIKeyDTO, creator *shared.Principal) (*IssuedAPIKeyDTO, error) {
+	tenantID := dto.TenantID
+	if creator.TenantID != nil {
+		if tenantID != nil && *tenantID != *creator.TenantID {
+			return nil, shared.ErrTenantMismatch
+		}
+		tenantID = creator.TenantID
+	}
+
+	scopes := make(Scopes, 0, len(dto.Scopes))
+	for _, scope := range dto.Scopes {
+		if !validScope(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	if dto.ExpiresAt != nil && !dto.ExpiresAt.After(s.now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	raw, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &APIKey{
+		Name:        dto.Name,
+		Prefix:      raw[:len(APIKeyPrefix)+8],
+		KeyHash:     hashToken(raw),
+		Scopes:      scopes,
+		CreatedByID: creator.ID,
+		TenantID:    tenantID,
+		ExpiresAt:   dto.ExpiresAt,
+	}
+	if err := s.repo.Create(key); err != nil {
+		return nil, err
+	}
+
+	return &IssuedAPIKeyDTO{APIKey: *key, Key: raw}, nil
+}
+
+// Rotate issues a new secret for the key keeping its scopes and expiry
+func (s *APIKeyService) Rotate(admin *shared.Principal, id uint) (*IssuedAPIKeyDTO, error) {
+	key, err := s.find(admin, id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+
+	raw, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	key.Prefix = raw[:len(APIKeyPrefix)+8]
+	key.KeyHash = hashToken(raw)
+	key.LastUsedAt = nil
+
+	if err := s.repo.Rotate(key); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyRevoked
+		}
+		return nil, err
+	}
+
+	return &IssuedAPIKeyDTO{APIKey: *key, Key: raw}, nil
+}
+
+func (s *APIKeyService) Revoke(admin *shared.Principal, id uint) error {
+	if _, err := s.find(admin, id); err != nil {
+		return err
+	}
+	return s.repo.Revoke(id, s.now())
+}
+
+// Authenticate validates an API key and returns the principal it identifies, its permissions are the key scopes
+func (s *APIKeyService) Authenticate(raw string) (*shared.Principal, error) {
+	key, err := s.repo.FindByHash(hashToken(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	now := s.now()
+	if !key.Active(now) {
+		return nil, ErrRevokedToken
+	}
+
+	if err := s.repo.TouchLastUsed(key.ID, now, lastUsedInterval); err != nil {
+		log.Printf("Error tracking usage of api key %d: %v", key.ID, err)
+	}
+
+	principal := &shared.Principal{
+		ID:          key.ID,
+		Type:        shared.PrincipalAPIKey,
+		Name:        key.Name,
+		Permissions: key.Scopes,
+		TenantID:    key.TenantID,
+	}
+	if key.ExpiresAt != nil {
+		principal.ExpiresAt = *key.ExpiresAt
+	}
+	return principal, nil
+}
+
+func newAPIKey() (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + raw, nil
+}
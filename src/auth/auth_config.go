@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 30 * 24 * time.Hour
+	defaultIssuer     = "api-qisur"
+)
+
+type Config struct {
+	Secret     []byte
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// LoadConfig reads the JWT settings from JWT_SECRET, JWT_ISSUER, JWT_ACCESS_TTL and JWT_REFRESH_TTL,
+// the TTLs use the time.ParseDuration format (e.g. 15m, 720h)
+func LoadConfig() (Config, error) {
+	config := Config{
+		Secret:     []byte(os.Getenv("JWT_SECRET")),
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		AccessTTL:  defaultAccessTTL,
+		RefreshTTL: defaultRefreshTTL,
+	}
+
+	if len(config.Secret) < 32 {
+		return config, errors.New("JWT_SECRET must be at least 32 characters long")
+	}
+
+	if config.Issuer == "" {
+		config.Issuer = defaultIssuer
+	}
+
+	if ttl := os.Getenv("JWT_ACCESS_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return config, errors.New("invalid JWT_ACCESS_TTL")
+		}
+		config.AccessTTL = d
+	}
+
+	if ttl := os.Getenv("JWT_REFRESH_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return config, errors.New("invalid JWT_REFRESH_TTL")
+		}
+		config.RefreshTTL = d
+	}
+
+	return config, nil
+}
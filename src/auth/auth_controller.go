@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type AuthController struct {
+	service   *AuthService
+	validator *shared.XValidator
+}
+
+func NewAuthController(service *AuthService, validator *shared.XValidator) *AuthController {
+	return &AuthController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+func (ac *AuthController) Routes() []shared.Route {
+	return []shared.Route{
+		{Method: fiber.MethodPost, Path: "/api/v1/auth/login", Handler: ac.Login, Public: true},
+		{Method: fiber.MethodPost, Path: "/api/v1/auth/refresh", Handler: ac.Refresh, Public: true},
+		{Method: fiber.MethodPost, Path: "/api/v1/auth/logout", Handler: ac.Logout},
+		{Method: fiber.MethodGet, Path: "/api/v1/auth/me", Handler: ac.Me},
+		{Method: fiber.MethodGet, Path: "/api/v1/users", Handler: ac.GetUsers, Permission: shared.PermUsersManage},
+		{Method: fiber.MethodPost, Path: "/api/v1/users", Handler: ac.CreateUser, Permission: shared.PermUsersManage},
+		{Method: fiber.MethodPut, Path: "/api/v1/users/:id/roles", Handler: ac.AssignRoles, Permission: shared.PermUsersManage},
+	}
+}
+
+func (ac *AuthController) RegisterRoutes(app *fiber.App, guard shared.RouteGuard) {
+	shared.RegisterRoutes(app, guard, ac.Routes())
+}
+
+// @Summary Log in
+// @Description Exchange email and password for an access token and a refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body LoginDTO true "User credentials"
+// @Success 200 {object} shared.Response{data=TokenPairDTO} "Token pair"
+// @Failure 400 {object} shared.Response "Invalid request body"
+// @Failure 401 {object} shared.Response "Invalid credentials"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /auth/login [post]
+func (ac *AuthController) Login(c fiber.Ctx) error {
+	var dto LoginDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if errs := ac.validator.Validate(dto); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	tokens, err := ac.service.Login(dto.Email, dto.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return shared.NewErrorResponse(c, fiber.StatusUnauthorized, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to log in")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, tokens)
+}
+
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new token pair. The refresh token is rotated, reusing an old one revokes every token issued from the same login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body RefreshDTO true "Refresh token"
+// @Success 200 {object} shared.Response{data=TokenPairDTO} "Token pair"
+// @Failure 400 {object} shared.Response "Invalid request body"
+// @Failure 401 {object} shared.Response "Invalid, expired or revoked refresh token"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /auth/refresh [post]
+func (ac *AuthController) Refresh(c fiber.Ctx) error {
+	var dto RefreshDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if errs := ac.validator.Validate(dto); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	tokens, err := ac.service.Refresh(dto.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrRevokedToken) {
+			return shared.NewErrorResponse(c, fiber.StatusUnauthorized, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to refresh token")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, tokens)
+}
+
+// @Summary Log out
+// @Description Revoke the current access token and the given refresh token, or every session of the user with all
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param logout body LogoutDTO false "Refresh token to revoke"
+// @Success 200 {object} shared.Response "Logged out"
+// @Failure 400 {object} shared.Response "Invalid request body"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Not a user"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /auth/logout [post]
+func (ac *AuthController) Logout(c fiber.Ctx) error {
+	var dto LogoutDTO
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&dto); err != nil {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	principal, _ := shared.PrincipalFrom(c)
+	if principal.Type != shared.PrincipalUser {
+		return shared.NewErrorResponse(c, fiber.StatusForbidden, "Only users can log out")
+	}
+
+	if err := ac.service.Logout(principal, dto.RefreshToken, dto.All); err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to log out")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, "Logged out successfully")
+}
+
+// @Summary Current user
+// @Description Get the authenticated user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} shared.Response{data=User} "OK with the user"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Not a user"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /auth/me [get]
+func (ac *AuthController) Me(c fiber.Ctx) error {
+	principal, _ := shared.PrincipalFrom(c)
+	if principal.Type != shared.PrincipalUser {
+		return shared.NewErrorResponse(c, fiber.StatusForbidden, "Only users have a profile")
+	}
+
+	user, err := ac.service.FindUserByID(principal.ID)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch user")
+	}
+	return shared.NewSuccessResponse(c, fiber.StatusOK, user)
+}
+
+// @Summary Get users
+// @Description Get a paginated list of users with their roles
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Param cursor query string false "Opaque cursor from next_cursor to read the following rows (keyset pagination)"
+// @Param sort query string false "Comma separated fields to sort by, prefix with - for descending (e.g. -created_at)"
+// @Param filter query string false "Generic filters as filter[field][op]=value"
+// @Success 200 {object} shared.PaginatedResponse{data=[]User} "OK with paginated users"
+// @Failure 400 {object} shared.Response "Invalid query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Users not found"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /users [get]
+func (ac *AuthController) GetUsers(c fiber.Ctx) error {
+	var q UserQueryDTO
+	if err := c.Bind().Query(&q); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalids query params")
+	}
+
+	if errs := ac.validator.Validate(q); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	filters, err := q.ToCriterions()
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	queryFilters, err := shared.ParseFilters(c.Queries(), UserSchema)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+	filters = append(queryFilters, filters...)
+
+	principal, _ := shared.PrincipalFrom(c)
+	users, total, err := ac.service.FindUsers(principal, filters)
+	if err != nil {
+		if shared.IsCriteriaError(err) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch users")
+	}
+
+	if len(users) == 0 {
+		return shared.NewErrorResponse(c, fiber.StatusNotFound, "Users not found")
+	}
+
+	return shared.NewPaginatedResponse(c, fiber.StatusFound, users, q.pageInfo(users, total, filters))
+}
+
+// @Summary Create a user
+// @Description Create a user with the given roles. Admins bound to a tenant create users of their tenant
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param user body CreateUserDTO true "User data"
+// @Success 201 {object} shared.Response{data=User} "User created successfully"
+// @Failure 400 {object} shared.Response "Invalid request body"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden or tenant not allowed"
+// @Failure 409 {object} shared.Response "Email already registered"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /users [post]
+func (ac *AuthController) CreateUser(c fiber.Ctx) error {
+	var dto CreateUserDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if errs := ac.validator.Validate(dto); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	principal, _ := shared.PrincipalFrom(c)
+	user, err := ac.service.CreateUser(principal, &dto)
+	if err != nil {
+		if errors.Is(err, shared.ErrTenantMismatch) {
+			return shared.NewErrorResponse(c, fiber.StatusForbidden, "Forbidden: tenant not allowed")
+		}
+		if errors.Is(err, ErrEmailTaken) {
+			return shared.NewErrorResponse(c, fiber.StatusConflict, err.Error())
+		}
+		if errors.Is(err, ErrInvalidRole) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to create user")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusCreated, user)
+}
+
+// @Summary Assign roles to a user
+// @Description Replace the roles of a user (admin, editor, viewer, client)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param roles body AssignRolesDTO true "Roles"
+// @Success 200 {object} shared.Response{data=User} "User with the new roles"
+// @Failure 400 {object} shared.Response "Invalid user ID or request body"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "User not found"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /users/{id}/roles [put]
+func (ac *AuthController) AssignRoles(c fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	var dto AssignRolesDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if errs := ac.validator.Validate(dto); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	principal, _ := shared.PrincipalFrom(c)
+	user, err := ac.service.AssignRoles(principal, uint(id), dto.Roles)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "User not found")
+		}
+		if errors.Is(err, ErrInvalidRole) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to assign roles")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, user)
+}
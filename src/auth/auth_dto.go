@@ -0,0 +1,72 @@
+package auth
+
+import "github.com/Javieradel/api-qisur.git/src/shared"
+
+type LoginDTO struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type RefreshDTO struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LogoutDTO struct {
+	RefreshToken string `json:"refresh_token"`
+	// All revokes every refresh token of the user, logging out all of its sessions
+	All bool `json:"all"`
+}
+
+type TokenPairDTO struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type UserQueryDTO struct {
+	Page   int    `query:"page" validate:"gte=0"`
+	Limit  int    `query:"limit" validate:"gte=0,lte=100"`
+	Cursor string `query:"cursor"`
+	Sort   string `query:"sort"`
+}
+
+func (dto *UserQueryDTO) ToCriterions() ([]shared.Criterion, error) {
+	sorts, err := shared.ParseSort(dto.Sort, UserSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	pagination, err := shared.PaginationCriteria(dto.Page, dto.Limit, dto.Cursor, sorts)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(sorts, pagination...), nil
+}
+
+func (dto *UserQueryDTO) pageInfo(users []User, total int64, criteria []shared.Criterion) shared.PageInfo {
+	_, limit := shared.NormalizePagination(dto.Page, dto.Limit)
+	info := shared.PageInfo{
+		Page:       dto.Page,
+		Limit:      dto.Limit,
+		TotalItems: total,
+		Cursor:     dto.Cursor,
+	}
+	if len(users) > 0 {
+		info.NextCursor = shared.NextCursor(users[len(users)-1], criteria, len(users), limit)
+	}
+	return info
+}
+
+type CreateUserDTO struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Name     string   `json:"name"`
+	Password string   `json:"password" validate:"required,min=8"`
+	TenantID *uint    `json:"tenant_id"`
+	Roles    []string `json:"roles" validate:"dive,oneof=admin editor viewer client"`
+}
+
+type AssignRolesDTO struct {
+	Roles []string `json:"roles" validate:"required,dive,oneof=admin editor viewer client"`
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/gofiber/fiber/v3"
+)
+
+// NewAuthMiddleware requires a valid `Authorization: Bearer <token>` or `Authorization: ApiKey <key>` header
+// and sets the principal of the request. Browsers can't set headers on WebSocket handshakes nor event streams,
+// so those requests may send the credentials in the access_token or api_key query params instead
+func NewAuthMiddleware(service *AuthService, apiKeys *APIKeyService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		scheme, credentials := credentialsOf(c)
+		if credentials == "" {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="api", ApiKey realm="api"`)
+			return shared.NewErrorResponse(c, fiber.StatusUnauthorized, "Missing credentials")
+		}
+
+		var principal *shared.Principal
+		var err error
+		switch {
+		case strings.EqualFold(scheme, "Bearer"):
+			principal, err = service.Authenticate(credentials)
+		case strings.EqualFold(scheme, "ApiKey"):
+			principal, err = apiKeys.Authenticate(credentials)
+		default:
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="api", ApiKey realm="api"`)
+			return shared.NewErrorResponse(c, fiber.StatusUnauthorized, "Unsupported authorization scheme")
+		}
+
+		if err != nil {
+			if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrRevokedToken) {
+				c.Set(fiber.HeaderWWWAuthenticate, scheme+` realm="api", error="invalid_token"`)
+				return shared.NewErrorResponse(c, fiber.StatusUnauthorized, "Invalid or expired credentials")
+			}
+			return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to authenticate")
+		}
+
+		shared.SetPrincipal(c, principal)
+		c.SetContext(shared.WithActor(c.Context(), shared.NewActor(principal, c.IP(), c.Get(fiber.HeaderUserAgent))))
+		return c.Next()
+	}
+}
+
+// Authorize requires the principal set by the authentication middleware to hold the permission
+func Authorize(permission shared.Permission) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		principal, found := shared.PrincipalFrom(c)
+		if !found {
+			return shared.NewErrorResponse(c, fiber.StatusUnauthorized, "Unauthorized")
+		}
+
+		if !principal.Can(permission) {
+			return shared.NewErrorResponse(c, fiber.StatusForbidden, "Forbidden: requires "+string(permission)+" permission")
+		}
+
+		return c.Next()
+	}
+}
+
+func credentialsOf(c fiber.Ctx) (string, string) {
+	if header := c.Get(fiber.HeaderAuthorization); header != "" || !shared.IsStreamRequest(c) {
+		scheme, credentials, _ := strings.Cut(header, " ")
+		return scheme, strings.TrimSpace(credentials)
+	}
+
+	if token := c.Query("access_token"); token != "" {
+		return "Bearer", token
+	}
+	return "ApiKey", c.Query("api_key")
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AuthRepository struct {
+	DB *gorm.DB
+}
+
+func NewAuthRepository(db *gorm.DB) *AuthRepository {
+	return &AuthRepository{DB: db}
+}
+
+func (r *AuthRepository) FindUserByEmail(email string) (*User, error) {
+	var user User
+	if err := r.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *AuthRepository) FindUserByID(id uint) (*User, error) {
+	var user User
+	if err := r.DB.Preload("Roles").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUsers returns the users matching the criteria, only the ones of the tenant when tenantID is set
+func (r *AuthRepository) FindUsers(tenantID *uint, criteria []shared.Criterion) ([]User, int64, error) {
+	var found []User
+	var total int64
+
+	users := func() *gorm.DB {
+		query := r.DB.Model(&User{})
+		if tenantID != nil {
+			query = query.Where("tenant_id = ?", *tenantID)
+		}
+		return query
+	}
+
+	countQuery, err := shared.ApplyCriteria(users(), UserSchema, shared.WithoutPagination(criteria))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := countQuery.Count(&total).Error; err != nil {
+		log.Printf("Error counting users %+v: %v", criteria, err)
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	query, err := shared.ApplyCriteria(users().Preload("Roles"), UserSchema, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Find(&found).Error; err != nil {
+		log.Printf("Error fetching users %+v: %v", criteria, err)
+		return nil, 0, fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	return found, total, nil
+}
+
+// CreateUser stores the user along with its roles
+func (r *AuthRepository) CreateUser(user *User) error {
+	return r.DB.Create(user).Error
+}
+
+// ReplaceRoles sets the roles of the user, removing the ones not listed
+func (r *AuthRepository) ReplaceRoles(userID uint, roles []Role) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		if len(roles) == 0 {
+			return nil
+		}
+		userRoles := make([]UserRole, len(roles))
+		for i, role := range roles {
+			userRoles[i] = UserRole{UserID: userID, Role: role}
+		}
+		return tx.Create(&userRoles).Error
+	})
+}
+
+func (r *AuthRepository) CreateRefreshToken(token *RefreshToken) error {
+	return r.DB.Create(token).Error
+}
+
+func (r *AuthRepository) FindRefreshTokenByHash(hash string) (*RefreshToken, error) {
+	var token RefreshToken
+	if err := r.DB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken revokes the current token and stores its replacement in the same transaction,
+// it fails with gorm.ErrRecordNotFound when the current token was revoked concurrently
+func (r *AuthRepository) RotateRefreshToken(current *RefreshToken, next *RefreshToken) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]any{"revoked_at": time.Now(), "replaced_by_id": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *AuthRepository) RevokeRefreshToken(id uint) error {
+	return r.DB.Model(&RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *AuthRepository) RevokeRefreshFamily(familyID uuid.UUID) error {
+	return r.DB.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *AuthRepository) RevokeUserRefreshTokens(userID uint) error {
+	return r.DB.Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *AuthRepository) RevokeAccessToken(token *RevokedAccessToken) error {
+	return r.DB.Where(RevokedAccessToken{TokenID: token.TokenID}).FirstOrCreate(token).Error
+}
+
+func (r *AuthRepository) IsAccessTokenRevoked(tokenID string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&RevokedAccessToken{}).Where("token_id = ?", tokenID).Count(&count).Error
+	return count > 0, err
+}
+
+// PurgeExpired removes the revoked access tokens and refresh tokens that already expired
+func (r *AuthRepository) PurgeExpired(now time.Time) error {
+	if err := r.DB.Where("expires_at < ?", now).Delete(&RevokedAccessToken{}).Error; err != nil {
+		return err
+	}
+	return r.DB.Where("expires_at < ?", now).Delete(&RefreshToken{}).Error
+}
@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrRevokedToken       = errors.New("token has been revoked")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrEmailTaken         = errors.New("email is already registered")
+)
+
+// dummyPasswordHash is compared on logins of unknown users, it has the cost of the hashes of the users
+const dummyPasswordHash = "$2a$10$vn7qiY/Es6Q.csWgu4.onuJXPTvbvHbvO8ppNqPjXB0SJ0Ms8ZRDC"
+
+type AuthService struct {
+	repo   *AuthRepository
+	config Config
+	now    func() time.Time
+}
+
+func NewAuthService(repo *AuthRepository, config Config) *AuthService {
+	return &AuthService{repo: repo, config: config, now: time.Now}
+}
+
+// Login checks the credentials and issues a new token pair starting a new refresh token family
+func (s *AuthService) Login(email, password string) (*TokenPairDTO, error) {
+	user, err := s.repo.FindUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// pay the bcrypt cost anyway so the response time does not tell which accounts exist
+			(&User{PasswordHash: dummyPasswordHash}).CheckPassword(password)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if !user.CheckPassword(password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	refresh, raw, err := s.newRefreshToken(user.ID, uuid.New())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateRefreshToken(refresh); err != nil {
+		return nil, err
+	}
+
+	return s.tokenPair(user, raw)
+}
+
+// Refresh exchanges a refresh token for a new pair, the used token is rotated out.
+// Presenting a token that was already rotated means it leaked, so its whole family is revoked
+func (s *AuthService) Refresh(raw string) (*TokenPairDTO, error) {
+	current, err := s.repo.FindRefreshTokenByHash(hashToken(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		if current.ReplacedByID != nil {
+			log.Printf("Refresh token reuse detected for user %d, revoking family %s", current.UserID, current.FamilyID)
+			if err := s.repo.RevokeRefreshFamily(current.FamilyID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrRevokedToken
+	}
+
+	if s.now().After(current.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.repo.FindUserByID(current.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	next, nextRaw, err := s.newRefreshToken(user.ID, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.RotateRefreshToken(current, next); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRevokedToken
+		}
+		return nil, err
+	}
+
+	return s.tokenPair(user, nextRaw)
+}
+
+// Logout revokes the access token of the principal and the given refresh token,
+// or every refresh token of the user when all is set
+func (s *AuthService) Logout(principal *shared.Principal, refreshToken string, all bool) error {
+	if principal.TokenID != "" {
+		err := s.repo.RevokeAccessToken(&RevokedAccessToken{
+			TokenID:   principal.TokenID,
+			UserID:    principal.ID,
+			ExpiresAt: principal.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if all {
+		return s.repo.RevokeUserRefreshTokens(principal.ID)
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	token, err := s.repo.FindRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if token.UserID != principal.ID {
+		return ErrInvalidToken
+	}
+	return s.repo.RevokeRefreshToken(token.ID)
+}
+
+// Authenticate validates an access token and returns the principal it identifies
+func (s *AuthService) Authenticate(token string) (*shared.Principal, error) {
+	claims, err := parseAccessToken(s.config, token)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.repo.IsAccessTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrRevokedToken
+	}
+
+	id, err := claims.UserID()
+	if err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+
+	// the roles are read on every request so role changes apply without waiting for the token to expire
+	user, err := s.repo.FindUserByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return &shared.Principal{
+		ID:          user.ID,
+		Type:        shared.PrincipalUser,
+		Email:       user.Email,
+		Name:        user.Name,
+		Roles:       user.RoleNames(),
+		Permissions: PermissionsOf(user.Roles),
+		TenantID:    user.TenantID,
+		TokenID:     claims.ID,
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}, nil
+}
+
+func (s *AuthService) FindUserByID(id uint) (*User, error) {
+	return s.repo.FindUserByID(id)
+}
+
+// FindUsers lists the users visible to the admin, the admins bound to a tenant only see the users of their tenant
+func (s *AuthService) FindUsers(admin *shared.Principal, criteria []shared.Criterion) ([]User, int64, error) {
+	return s.repo.FindUsers(admin.TenantID, criteria)
+}
+
+// CreateUser creates a user, the admins bound to a tenant can only create users of their tenant
+func (s *AuthService) CreateUser(admin *shared.Principal, dto *CreateUserDTO) (*User, error) {
+	roles, err := parseRoles(dto.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantID := dto.TenantID
+	if admin.TenantID != nil {
+		if tenantID != nil && *tenantID != *admin.TenantID {
+			return nil, shared.ErrTenantMismatch
+		}
+		tenantID = admin.TenantID
+	}
+
+	if _, err := s.repo.FindUserByEmail(dto.Email); err == nil {
+		return nil, ErrEmailTaken
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	hash, err := HashPassword(dto.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{Email: dto.Email, Name: dto.Name, PasswordHash: hash, TenantID: tenantID}
+	for _, role := range roles {
+		user.Roles = append(user.Roles, UserRole{Role: role})
+	}
+	if err := s.repo.CreateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AssignRoles replaces the roles of the user, the admins bound to a tenant can only manage the users of their tenant
+func (s *AuthService) AssignRoles(admin *shared.Principal, userID uint, names []string) (*User, error) {
+	roles, err := parseRoles(names)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if admin.TenantID != nil && (user.TenantID == nil || *user.TenantID != *admin.TenantID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if err := s.repo.ReplaceRoles(userID, roles); err != nil {
+		return nil, err
+	}
+	return s.repo.FindUserByID(userID)
+}
+
+func parseRoles(names []string) ([]Role, error) {
+	roles := make([]Role, 0, len(names))
+	for _, name := range names {
+		role := Role(name)
+		if !role.Valid() {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRole, name)
+		}
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (s *AuthService) tokenPair(user *User, refreshToken string) (*TokenPairDTO, error) {
+	access, _, err := signAccessToken(s.config, user, s.now())
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPairDTO{
+		AccessToken:  access,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.config.AccessTTL.Seconds()),
+	}, nil
+}
+
+func (s *AuthService) newRefreshToken(userID uint, familyID uuid.UUID) (*RefreshToken, string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	return &RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: s.now().Add(s.config.RefreshTTL),
+	}, raw, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes the high entropy refresh tokens, a fast hash is enough as they can't be brute forced
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// AccessClaims are the claims of the short lived access tokens
+type AccessClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the ID of the user stored in the subject
+func (c *AccessClaims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid subject: %w", err)
+	}
+	return uint(id), nil
+}
+
+func signAccessToken(config Config, user *User, now time.Time) (string, *AccessClaims, error) {
+	claims := &AccessClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    config.Issuer,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(config.AccessTTL)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(config.Secret)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+func parseAccessToken(config Config, token string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return config.Secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+	RoleClient Role = "client"
+)
+
+// RolePermissions is the permission map of every role, a user is granted the union of its roles
+var RolePermissions = map[Role][]shared.Permission{
+	RoleAdmin: {
+		shared.PermProductsRead, shared.PermProductsWrite, shared.PermProductsDelete, shared.PermProductsPurge,
+		shared.PermCategoriesRead, shared.PermCategoriesWrite, shared.PermCategoriesDelete, shared.PermCategoriesPurge,
+		shared.PermHistoryRead, shared.PermUsersManage, shared.PermAPIKeysManage, shared.PermWebhooksManage,
+	},
+	RoleEditor: {
+		shared.PermProductsRead, shared.PermProductsWrite, shared.PermProductsDelete,
+		shared.PermCategoriesRead, shared.PermCategoriesWrite, shared.PermCategoriesDelete,
+		shared.PermHistoryRead,
+	},
+	RoleViewer: {
+		shared.PermProductsRead, shared.PermCategoriesRead, shared.PermHistoryRead,
+	},
+	RoleClient: {
+		shared.PermProductsRead, shared.PermCategoriesRead,
+	},
+}
+
+func (r Role) Valid() bool {
+	_, found := RolePermissions[r]
+	return found
+}
+
+// UserRole assigns a role to a user
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey" json:"-"`
+	Role      Role      `gorm:"primaryKey" json:"role"`
+	CreatedAt time.Time `json:"assigned_at"`
+}
+
+func (UserRole) TableName() string {
+	return "user_roles"
+}
+
+// PermissionsOf returns the sorted union of the permissions granted by the roles
+func PermissionsOf(roles []UserRole) []shared.Permission {
+	permissions := make([]shared.Permission, 0)
+	for _, role := range roles {
+		for _, permission := range RolePermissions[role.Role] {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	slices.Sort(permissions)
+	return permissions
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is an opaque long lived token exchanged for new access tokens.
+// Only its hash is stored, tokens issued from the same login share a family so
+// a reused (already rotated) token revokes the whole family
+type RefreshToken struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UserID       uint      `gorm:"index"`
+	FamilyID     uuid.UUID `gorm:"type:uuid;index"`
+	TokenHash    string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt    time.Time
+	RevokedAt    *time.Time
+	ReplacedByID *uint
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// RevokedAccessToken blocks an access token before it expires, e.g. on logout
+type RevokedAccessToken struct {
+	TokenID   string    `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (RevokedAccessToken) TableName() string {
+	return "revoked_access_tokens"
+}
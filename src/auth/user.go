@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type User struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	Email        string         `gorm:"uniqueIndex;not null"`
+	Name         string
+	TenantID     *uint      `gorm:"index"`
+	PasswordHash string     `json:"-"`
+	Roles        []UserRole `gorm:"foreignKey:UserID" json:"roles"`
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+// UserSchema whitelists the user fields usable to filter and sort listings
+var UserSchema = shared.RegisterSchema(shared.Schema{
+	Table: "users",
+	Fields: map[string]shared.Field{
+		"id": {
+			Column:    "id",
+			Type:      shared.FieldInteger,
+			Operators: []shared.Operator{shared.OpEq, shared.OpIn, shared.OpNot},
+			Sortable:  true,
+		},
+		"email": {
+			Column:    "email",
+			Type:      shared.FieldString,
+			Operators: []shared.Operator{shared.OpEq, shared.OpLike, shared.OpILike, shared.OpIn, shared.OpNot},
+			Sortable:  true,
+		},
+		"name": {
+			Column:    "name",
+			Type:      shared.FieldString,
+			Operators: []shared.Operator{shared.OpEq, shared.OpLike, shared.OpILike, shared.OpNot},
+			Sortable:  true,
+		},
+		"created_at": {
+			Column:    "created_at",
+			Type:      shared.FieldTime,
+			Operators: []shared.Operator{shared.OpGt, shared.OpGte, shared.OpLt, shared.OpLte, shared.OpBetween},
+			Sortable:  true,
+		},
+	},
+})
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+func (u *User) RoleNames() []string {
+	names := make([]string, len(u.Roles))
+	for i, role := range u.Roles {
+		names[i] = string(role.Role)
+	}
+	return names
+}
@@ -2,17 +2,63 @@ package categories
 
 import (
 	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
 )
 
 type Categories struct {
-	ID          uint `gorm:"primarykey"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	DeletedAt   *time.Time
+	ID          uint           `gorm:"primarykey" history:"-"`
+	CreatedAt   time.Time      `history:"-"`
+	UpdatedAt   time.Time      `history:"-"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" history:"-"`
+	TenantID    uint           `gorm:"index;not null" history:"-"`
 	Name        string
 	Description string
 }
 
+func (c *Categories) BeforeCreate(tx *gorm.DB) error {
+	return shared.AssignTenant(tx, &c.TenantID)
+}
+
 func (Categories) TableName() string {
 	return "categories"
 }
+
+// CategorySchema whitelists the category fields usable to filter and sort listings
+var CategorySchema = shared.RegisterSchema(shared.Schema{
+	Table:    "categories",
+	Tenanted: true,
+	Fields: map[string]shared.Field{
+		"id": {
+			Column:    "id",
+			Type:      shared.FieldInteger,
+			Operators: []shared.Operator{shared.OpEq, shared.OpIn, shared.OpNot},
+			Sortable:  true,
+		},
+		"name": {
+			Column:    "name",
+			Type:      shared.FieldString,
+			Operators: []shared.Operator{shared.OpEq, shared.OpLike, shared.OpILike, shared.OpIn, shared.OpNot},
+			Sortable:  true,
+		},
+		"description": {
+			Column:    "description",
+			Type:      shared.FieldString,
+			Operators: []shared.Operator{shared.OpEq, shared.OpLike, shared.OpILike, shared.OpNot, shared.OpIsNull},
+			Sortable:  true,
+		},
+		"created_at": {
+			Column:    "created_at",
+			Type:      shared.FieldTime,
+			Operators: []shared.Operator{shared.OpGt, shared.OpGte, shared.OpLt, shared.OpLte, shared.OpBetween},
+			Sortable:  true,
+		},
+		"updated_at": {
+			Column:    "updated_at",
+			Type:      shared.FieldTime,
+			Operators: []shared.Operator{shared.OpGt, shared.OpGte, shared.OpLt, shared.OpLte, shared.OpBetween},
+			Sortable:  true,
+		},
+	},
+})
@@ -3,6 +3,7 @@ package categories
 import (
 	"errors"
 	"strconv"
+	"time"
 
 	"github.com/Javieradel/api-qisur.git/src/shared"
 	"github.com/gofiber/fiber/v3"
@@ -21,13 +22,24 @@ func NewCategoryController(service *CategoryService) *CategoryController {
 	}
 }
 
-func (cc *CategoryController) RegisterRoutes(app *fiber.App) {
-	app.Get("/api/v1/categories", cc.GetCategories)
-	app.Get("/api/v1/categories/:id", cc.GetCategoryByID)
-	app.Post("/api/v1/categories", cc.CreateCategory)
-	app.Put("/api/v1/categories/:id", cc.UpdateCategory)
-	app.Patch("/api/v1/categories/:id", cc.PatchCategory)
-	app.Delete("/api/v1/categories/:id", cc.DeleteCategory)
+// Routes declares the category endpoints and the permission each one requires
+func (cc *CategoryController) Routes() []shared.Route {
+	return []shared.Route{
+		{Method: fiber.MethodGet, Path: "/api/v1/categories", Handler: cc.GetCategories, Permission: shared.PermCategoriesRead},
+		{Method: fiber.MethodGet, Path: "/api/v1/categories/trash", Handler: cc.GetTrashedCategories, Permission: shared.PermCategoriesDelete},
+		{Method: fiber.MethodGet, Path: "/api/v1/categories/:id", Handler: cc.GetCategoryByID, Permission: shared.PermCategoriesRead},
+		{Method: fiber.MethodPost, Path: "/api/v1/categories", Handler: cc.CreateCategory, Permission: shared.PermCategoriesWrite},
+		{Method: fiber.MethodPut, Path: "/api/v1/categories/:id", Handler: cc.UpdateCategory, Permission: shared.PermCategoriesWrite},
+		{Method: fiber.MethodPatch, Path: "/api/v1/categories/:id", Handler: cc.PatchCategory, Permission: shared.PermCategoriesWrite},
+		{Method: fiber.MethodDelete, Path: "/api/v1/categories/:id", Handler: cc.DeleteCategory, Permission: shared.PermCategoriesDelete},
+		{Method: fiber.MethodPost, Path: "/api/v1/categories/:id/restore", Handler: cc.RestoreCategory, Permission: shared.PermCategoriesDelete},
+		{Method: fiber.MethodDelete, Path: "/api/v1/categories/:id/purge", Handler: cc.PurgeCategory, Permission: shared.PermCategoriesPurge},
+		{Method: fiber.MethodGet, Path: "/api/v1/categories/:id/history", Handler: cc.GetCategoryHistory, Permission: shared.PermHistoryRead},
+	}
+}
+
+func (cc *CategoryController) RegisterRoutes(app *fiber.App, guard shared.RouteGuard) {
+	shared.RegisterTenantRoutes(app, guard, cc.Routes())
 }
 
 // @Summary Get all categories
@@ -35,12 +47,19 @@ func (cc *CategoryController) RegisterRoutes(app *fiber.App) {
 // @Tags categories
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Number of items per page" default(10)
+// @Param cursor query string false "Opaque cursor from next_cursor to read the following rows (keyset pagination)"
+// @Param sort query string false "Comma separated fields to sort by, prefix with - for descending (e.g. -price,name)"
+// @Param filter query string false "Generic filters as filter[field][op]=value, filter[not][field][op]=value or filter[or][group][field][op]=value (ops: eq, ne, gt, gte, lt, lte, in, like, ilike, null, between)"
 // @Param name query string false "Filter by category name (partial match)"
 // @Param description query string false "Filter by category description (partial match)"
 // @Success 200 {object} shared.PaginatedResponse{data=[]Categories} "OK with paginated categories"
 // @Failure 400 {object} shared.Response "Invalid query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Categories not found"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /categories [get]
@@ -50,9 +69,22 @@ func (cc *CategoryController) GetCategories(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalids query params")
 	}
 
-	filters := q.ToCriterions()
-	categories, err := cc.service.FindAll(filters)
+	filters, err := q.ToCriterions()
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	queryFilters, err := shared.ParseFilters(c.Queries(), CategorySchema)
 	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+	filters = append(queryFilters, filters...)
+
+	categories, total, err := cc.service.FindAll(c.Context(), filters)
+	if err != nil {
+		if shared.IsCriteriaError(err) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch categories")
 	}
 
@@ -60,11 +92,7 @@ func (cc *CategoryController) GetCategories(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusNotFound, "Categories not found")
 	}
 
-	if q.Limit > 0 || q.Page > 0 {
-		return shared.NewPaginatedResponse(c, fiber.StatusFound, categories, q.Page, q.Limit)
-	}
-
-	return shared.NewSuccessResponse(c, fiber.StatusFound, categories)
+	return shared.NewPaginatedResponse(c, fiber.StatusFound, categories, q.pageInfo(categories, total, filters))
 }
 
 // @Summary Get category by ID
@@ -72,9 +100,13 @@ func (cc *CategoryController) GetCategories(c fiber.Ctx) error {
 // @Tags categories
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Category ID"
 // @Success 200 {object} shared.Response{data=Categories} "OK with category data"
 // @Failure 400 {object} shared.Response "Invalid category ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Category not found"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /categories/{id} [get]
@@ -85,7 +117,7 @@ func (cc *CategoryController) GetCategoryByID(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid category ID")
 	}
 
-	category, err := cc.service.FindByID(uint(id))
+	category, err := cc.service.FindByID(c.Context(), uint(id))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Category not found")
@@ -101,9 +133,13 @@ func (cc *CategoryController) GetCategoryByID(c fiber.Ctx) error {
 // @Tags categories
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param category body CreateCategoryDTO true "Category data"
 // @Success 201 {object} shared.Response{data=Categories} "Category created successfully"
 // @Failure 400 {object} shared.Response "Invalid request body"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 422 {object} shared.Response "Validation failed"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /categories [post]
@@ -118,7 +154,7 @@ func (cc *CategoryController) CreateCategory(c fiber.Ctx) error {
 	}
 
 	category := dto.ToCategory()
-	if err := cc.service.Create(category); err != nil {
+	if err := cc.service.Create(c.Context(), category); err != nil {
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to create category")
 	}
 
@@ -130,10 +166,14 @@ func (cc *CategoryController) CreateCategory(c fiber.Ctx) error {
 // @Tags categories
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Category ID"
 // @Param category body UpdateCategoryDTO true "Category data"
 // @Success 200 {object} shared.Response{data=Categories} "Category updated successfully"
 // @Failure 400 {object} shared.Response "Invalid request body or category ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Category not found"
 // @Failure 422 {object} shared.Response "Validation failed"
 // @Failure 500 {object} shared.Response "Internal server error"
@@ -154,7 +194,7 @@ func (cc *CategoryController) UpdateCategory(c fiber.Ctx) error {
 		return shared.NewValidationErrorResponse(c, errs)
 	}
 
-	category, err := cc.service.FindByID(uint(id))
+	category, err := cc.service.FindByID(c.Context(), uint(id))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Category not found")
@@ -165,7 +205,7 @@ func (cc *CategoryController) UpdateCategory(c fiber.Ctx) error {
 	category.Name = dto.Name
 	category.Description = dto.Description
 
-	if err := cc.service.Update(category); err != nil {
+	if err := cc.service.Update(c.Context(), category); err != nil {
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to update category")
 	}
 
@@ -177,10 +217,14 @@ func (cc *CategoryController) UpdateCategory(c fiber.Ctx) error {
 // @Tags categories
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Category ID"
 // @Param category body PatchCategoryDTO true "Category data"
 // @Success 200 {object} shared.Response{data=Categories} "Category updated successfully"
 // @Failure 400 {object} shared.Response "Invalid request body or category ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Category not found"
 // @Failure 422 {object} shared.Response "Validation failed"
 // @Failure 500 {object} shared.Response "Internal server error"
@@ -201,7 +245,7 @@ func (cc *CategoryController) PatchCategory(c fiber.Ctx) error {
 		return shared.NewValidationErrorResponse(c, errs)
 	}
 
-	category, err := cc.service.FindByID(uint(id))
+	category, err := cc.service.FindByID(c.Context(), uint(id))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Category not found")
@@ -216,7 +260,7 @@ func (cc *CategoryController) PatchCategory(c fiber.Ctx) error {
 		category.Description = *dto.Description
 	}
 
-	if err := cc.service.Update(category); err != nil {
+	if err := cc.service.Update(c.Context(), category); err != nil {
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to update category")
 	}
 
@@ -224,13 +268,17 @@ func (cc *CategoryController) PatchCategory(c fiber.Ctx) error {
 }
 
 // @Summary Delete a category
-// @Description Delete an existing category by its ID
+// @Description Soft delete an existing category by its ID, it can be restored from the trash
 // @Tags categories
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Category ID"
 // @Success 200 {object} shared.Response "Category deleted successfully"
 // @Failure 400 {object} shared.Response "Invalid category ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Category not found"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /categories/{id} [delete]
@@ -241,7 +289,7 @@ func (cc *CategoryController) DeleteCategory(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid category ID")
 	}
 
-	_, err = cc.service.FindByID(uint(id))
+	_, err = cc.service.FindByID(c.Context(), uint(id))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Category not found")
@@ -249,9 +297,217 @@ func (cc *CategoryController) DeleteCategory(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch category")
 	}
 
-	if err := cc.service.Delete(uint(id)); err != nil {
+	if err := cc.service.Delete(c.Context(), uint(id)); err != nil {
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete category")
 	}
 
 	return shared.NewSuccessResponse(c, fiber.StatusOK, "Category deleted successfully")
-}
\ No newline at end of file
+}
+
+// @Summary Get trashed categories
+// @Description Get a paginated list of soft deleted categories with optional filters
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Param cursor query string false "Opaque cursor from next_cursor to read the following rows (keyset pagination)"
+// @Param sort query string false "Comma separated fields to sort by, prefix with - for descending (e.g. -price,name)"
+// @Param filter query string false "Generic filters as filter[field][op]=value, filter[not][field][op]=value or filter[or][group][field][op]=value (ops: eq, ne, gt, gte, lt, lte, in, like, ilike, null, between)"
+// @Param name query string false "Filter by category name (partial match)"
+// @Param description query string false "Filter by category description (partial match)"
+// @Success 200 {object} shared.PaginatedResponse{data=[]Categories} "OK with paginated trashed categories"
+// @Failure 400 {object} shared.Response "Invalid query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /categories/trash [get]
+func (cc *CategoryController) GetTrashedCategories(c fiber.Ctx) error {
+	var q CategoryQueryDTO
+	if err := c.Bind().Query(&q); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalids query params")
+	}
+
+	filters, err := q.ToCriterions()
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	queryFilters, err := shared.ParseFilters(c.Queries(), CategorySchema)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+	filters = append(queryFilters, filters...)
+
+	categories, total, err := cc.service.FindTrashed(c.Context(), filters)
+	if err != nil {
+		if shared.IsCriteriaError(err) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch trashed categories")
+	}
+
+	return shared.NewPaginatedResponse(c, fiber.StatusOK, categories, q.pageInfo(categories, total, filters))
+}
+
+// @Summary Restore a category
+// @Description Restore a soft deleted category from the trash
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Category ID"
+// @Success 200 {object} shared.Response{data=Categories} "Category restored successfully"
+// @Failure 400 {object} shared.Response "Invalid category ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Category not found in trash"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /categories/{id}/restore [post]
+func (cc *CategoryController) RestoreCategory(c fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid category ID")
+	}
+
+	if _, err := cc.service.FindTrashedByID(c.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Category not found in trash")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch category")
+	}
+
+	if err := cc.service.Restore(c.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Category not found in trash")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to restore category")
+	}
+
+	category, err := cc.service.FindByID(c.Context(), uint(id))
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch category")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, category)
+}
+
+// @Summary Purge a category
+// @Description Permanently delete a trashed category and unlink it from its products
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Category ID"
+// @Success 200 {object} shared.Response "Category purged successfully"
+// @Failure 400 {object} shared.Response "Invalid category ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Category not found in trash"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /categories/{id}/purge [delete]
+func (cc *CategoryController) PurgeCategory(c fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid category ID")
+	}
+
+	if _, err := cc.service.FindTrashedByID(c.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Category not found in trash")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch category")
+	}
+
+	if err := cc.service.Purge(c.Context(), uint(id)); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to purge category")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, "Category purged successfully")
+}
+
+// @Summary Get category history
+// @Description Get the history of changes for a category
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Category ID"
+// @Param start query string false "Start date for history (YYYY-MM-DD)"
+// @Param end query string false "End date for history (YYYY-MM-DD)"
+// @Param actor_id query int false "Only the changes made by this user or API key ID"
+// @Param actor_type query string false "Only the changes made by this kind of actor" Enums(user, api_key, system)
+// @Success 200 {object} shared.Response{data=[]CategoryHistory} "OK with category history"
+// @Failure 400 {object} shared.Response "Invalid category ID or query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Category not found"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /categories/{id}/history [get]
+func (cc *CategoryController) GetCategoryHistory(c fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid category ID")
+	}
+
+	layout := "2006-01-02"
+	var filter CategoryHistoryFilter
+
+	if startStr := c.Query("start"); startStr != "" {
+		parsedTime, err := time.Parse(layout, startStr)
+		if err != nil {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid start date format, use YYYY-MM-DD")
+		}
+		filter.Start = &parsedTime
+	}
+
+	if endStr := c.Query("end"); endStr != "" {
+		parsedTime, err := time.Parse(layout, endStr)
+		if err != nil {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid end date format, use YYYY-MM-DD")
+		}
+		filter.End = &parsedTime
+	}
+
+	if actorIDStr := c.Query("actor_id"); actorIDStr != "" {
+		actorID, err := strconv.ParseUint(actorIDStr, 10, 32)
+		if err != nil {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid actor ID")
+		}
+		actor := uint(actorID)
+		filter.ActorID = &actor
+	}
+
+	switch actorType := c.Query("actor_type"); actorType {
+	case "", shared.PrincipalUser, shared.PrincipalAPIKey, shared.ActorSystem:
+		filter.ActorType = actorType
+	default:
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid actor type, use user, api_key or system")
+	}
+
+	// the history outlives the category, it is still listed once the category is trashed or purged
+	histories, err := cc.service.FindHistoryByCategoryID(c.Context(), uint(id), filter)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch category history")
+	}
+
+	if len(histories) == 0 {
+		if _, err := cc.service.FindByID(c.Context(), uint(id)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return shared.NewErrorResponse(c, fiber.StatusNotFound, "Category not found")
+			}
+			return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch category")
+		}
+		return shared.NewSuccessResponse(c, fiber.StatusOK, []CategoryHistory{})
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, histories)
+}
@@ -7,6 +7,8 @@ import (
 type CategoryQueryDTO struct {
 	Page        int    `query:"page" validate:"gte=0"`
 	Limit       int    `query:"limit" validate:"gte=0,lte=100"`
+	Cursor      string `query:"cursor"`
+	Sort        string `query:"sort"`
 	Name        string `query:"name"`
 	Description string `query:"description"`
 }
@@ -33,7 +35,7 @@ type PatchCategoryDTO struct {
 	Description *string `json:"description,omitempty"`
 }
 
-func (dto *CategoryQueryDTO) ToCriterions() []shared.Criterion {
+func (dto *CategoryQueryDTO) ToCriterions() ([]shared.Criterion, error) {
 	criterions := make([]shared.Criterion, 0)
 
 	if dto.Name != "" {
@@ -52,24 +54,30 @@ func (dto *CategoryQueryDTO) ToCriterions() []shared.Criterion {
 		})
 	}
 
-	limit := dto.Limit
-	if limit <= 0 {
-		limit = 10
+	sorts, err := shared.ParseSort(dto.Sort, CategorySchema)
+	if err != nil {
+		return nil, err
 	}
-	criterions = append(criterions, shared.Criterion{
-		Operator: shared.OpLimit,
-		Value:    limit,
-	})
+	criterions = append(criterions, sorts...)
 
-	page := dto.Page
-	if page <= 0 {
-		page = 1
+	pagination, err := shared.PaginationCriteria(dto.Page, dto.Limit, dto.Cursor, sorts)
+	if err != nil {
+		return nil, err
 	}
-	offset := (page - 1) * limit
-	criterions = append(criterions, shared.Criterion{
-		Operator: shared.OpOffset,
-		Value:    offset,
-	})
 
-	return criterions
+	return append(criterions, pagination...), nil
+}
+
+func (dto *CategoryQueryDTO) pageInfo(categories []Categories, total int64, criteria []shared.Criterion) shared.PageInfo {
+	_, limit := shared.NormalizePagination(dto.Page, dto.Limit)
+	info := shared.PageInfo{
+		Page:       dto.Page,
+		Limit:      dto.Limit,
+		TotalItems: total,
+		Cursor:     dto.Cursor,
+	}
+	if len(categories) > 0 {
+		info.NextCursor = shared.NextCursor(categories[len(categories)-1], criteria, len(categories), limit)
+	}
+	return info
 }
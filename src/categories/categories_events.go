@@ -0,0 +1,123 @@
+package categories
+
+import (
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+func init() {
+	shared.RegisterEvents(CategoryCreatedEvent{}, CategoryUpdatedEvent{}, CategoryDeletedEvent{},
+		CategoryRestoredEvent{}, CategoryPurgedEvent{})
+}
+
+// CategoryCreatedEvent is published when a category is created
+type CategoryCreatedEvent struct {
+	shared.Event
+	shared.EventMeta
+	Category Categories
+	Actor    shared.Actor
+}
+
+func (e CategoryCreatedEvent) Topic() string {
+	return "category.created"
+}
+
+func (e CategoryCreatedEvent) Tenant() uint {
+	return e.Category.TenantID
+}
+
+func (e CategoryCreatedEvent) Payload() any {
+	return e.Category
+}
+
+// CategoryUpdatedEvent is published when a category is updated
+type CategoryUpdatedEvent struct {
+	shared.Event
+	shared.EventMeta
+	OldCategory Categories
+	NewCategory Categories
+	Actor       shared.Actor
+}
+
+func (e CategoryUpdatedEvent) Topic() string {
+	return "category.updated"
+}
+
+func (e CategoryUpdatedEvent) Tenant() uint {
+	return e.NewCategory.TenantID
+}
+
+func (e CategoryUpdatedEvent) Payload() any {
+	return CategoryChange{Before: e.OldCategory, After: e.NewCategory}
+}
+
+// CategoryChange is the payload of CategoryUpdatedEvent
+type CategoryChange struct {
+	Before Categories
+	After  Categories
+}
+
+// CategoryDeletedEvent is published when a category is deleted
+type CategoryDeletedEvent struct {
+	shared.Event
+	shared.EventMeta
+	CategoryID uint
+	TenantID   uint
+	Actor      shared.Actor
+}
+
+func (e CategoryDeletedEvent) Topic() string {
+	return "category.deleted"
+}
+
+func (e CategoryDeletedEvent) Tenant() uint {
+	return e.TenantID
+}
+
+func (e CategoryDeletedEvent) Payload() any {
+	return map[string]uint{"ID": e.CategoryID}
+}
+
+// CategoryRestoredEvent is published when a category is taken out of the trash
+type CategoryRestoredEvent struct {
+	shared.Event
+	shared.EventMeta
+	Category Categories
+	// DeletedAt is when the category had been moved to the trash
+	DeletedAt time.Time
+	Actor     shared.Actor
+}
+
+func (e CategoryRestoredEvent) Topic() string {
+	return "category.restored"
+}
+
+func (e CategoryRestoredEvent) Tenant() uint {
+	return e.Category.TenantID
+}
+
+func (e CategoryRestoredEvent) Payload() any {
+	return e.Category
+}
+
+// CategoryPurgedEvent is published when a category is permanently removed, only its history is kept
+type CategoryPurgedEvent struct {
+	shared.Event
+	shared.EventMeta
+	CategoryID uint
+	TenantID   uint
+	Actor      shared.Actor
+}
+
+func (e CategoryPurgedEvent) Topic() string {
+	return "category.purged"
+}
+
+func (e CategoryPurgedEvent) Tenant() uint {
+	return e.TenantID
+}
+
+func (e CategoryPurgedEvent) Payload() any {
+	return map[string]uint{"ID": e.CategoryID}
+}
@@ -0,0 +1,80 @@
+package categories
+
+import (
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CategoryHistory represents the history of changes for a category
+type CategoryHistory struct {
+	ID         uint      `gorm:"primaryKey"`
+	UUID       uuid.UUID `gorm:"type:uuid;"`
+	CategoryID uint      `gorm:"index"`
+	TenantID   uint      `gorm:"index;not null"`
+	ChangedAt  time.Time
+	ActorID    *uint  `gorm:"index"`
+	ActorType  string `gorm:"type:varchar(32);index"`
+	IP         string `gorm:"type:varchar(64)"`
+	UserAgent  string `gorm:"type:text"`
+	// EventID is the idempotency key of the event recorded, an event is recorded once
+	EventID *uuid.UUID              `gorm:"type:uuid;uniqueIndex"`
+	Details []CategoryHistoryDetail `gorm:"foreignKey:CategoryHistoryID"`
+}
+
+// CategoryHistoryFilter narrows the history entries of a category
+type CategoryHistoryFilter struct {
+	Start     *time.Time
+	End       *time.Time
+	ActorID   *uint
+	ActorType string
+}
+
+func (h *CategoryHistory) BeforeCreate(tx *gorm.DB) (err error) {
+	if h.UUID == uuid.Nil {
+		h.UUID = uuid.New()
+	}
+	return shared.AssignTenant(tx, &h.TenantID)
+}
+
+func newCategoryHistory(category Categories, actor shared.Actor, meta shared.EventMeta) CategoryHistory {
+	eventID := meta.ID
+	return CategoryHistory{
+		UUID:       uuid.New(),
+		CategoryID: category.ID,
+		TenantID:   category.TenantID,
+		ChangedAt:  meta.OccurredAt,
+		EventID:    &eventID,
+		ActorID:    actor.ID,
+		ActorType:  actor.Type,
+		IP:         actor.IP,
+		UserAgent:  actor.UserAgent,
+	}
+}
+
+func (h CategoryHistory) HistoryID() uint {
+	return h.ID
+}
+
+func (CategoryHistory) TableName() string {
+	return "category_histories"
+}
+
+// CategoryHistoryDetail represents the details of a specific field change within a category history entry
+type CategoryHistoryDetail struct {
+	ID                uint                 `gorm:"primaryKey"`
+	CategoryHistoryID uint                 `gorm:"index"`
+	Field             string               `gorm:"type:varchar(255)"`
+	OldValue          *shared.HistoryValue `gorm:"type:jsonb"`
+	NewValue          *shared.HistoryValue `gorm:"type:jsonb"`
+}
+
+func (d *CategoryHistoryDetail) SetHistoryID(id uint) {
+	d.CategoryHistoryID = id
+}
+
+func (CategoryHistoryDetail) TableName() string {
+	return "category_history_details"
+}
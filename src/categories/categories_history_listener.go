@@ -0,0 +1,48 @@
+package categories
+
+import (
+	"context"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
+)
+
+type CategoryHistoryListener struct {
+	DB *gorm.DB
+}
+
+func NewCategoryHistoryListener(db *gorm.DB) *CategoryHistoryListener {
+	return &CategoryHistoryListener{DB: db}
+}
+
+// HandleTx records the history in the transaction of the change, so a change is never stored unaudited
+func (l *CategoryHistoryListener) HandleTx(ctx context.Context, event shared.Event) error {
+	switch e := event.(type) {
+	case CategoryCreatedEvent:
+		return l.record(ctx, newCategoryHistory(e.Category, e.Actor, e.EventMeta), shared.DiffFields(nil, e.Category))
+	case CategoryUpdatedEvent:
+		return l.record(ctx, newCategoryHistory(e.NewCategory, e.Actor, e.EventMeta), shared.DiffFields(e.OldCategory, e.NewCategory))
+	case CategoryDeletedEvent:
+		category := Categories{ID: e.CategoryID, TenantID: e.TenantID}
+		return l.record(ctx, newCategoryHistory(category, e.Actor, e.EventMeta), []shared.FieldChange{shared.DeletionChange(e.OccurredAt)})
+	case CategoryRestoredEvent:
+		return l.record(ctx, newCategoryHistory(e.Category, e.Actor, e.EventMeta), []shared.FieldChange{shared.RestorationChange(e.DeletedAt)})
+	case CategoryPurgedEvent:
+		category := Categories{ID: e.CategoryID, TenantID: e.TenantID}
+		return l.record(ctx, newCategoryHistory(category, e.Actor, e.EventMeta), []shared.FieldChange{shared.PurgeChange(e.OccurredAt)})
+	}
+	return nil
+}
+
+// record creates the entry along with a detail per changed field
+func (l *CategoryHistoryListener) record(ctx context.Context, history CategoryHistory, changes []shared.FieldChange) error {
+	details := make([]CategoryHistoryDetail, len(changes))
+	for i, change := range changes {
+		details[i] = CategoryHistoryDetail{
+			Field:    change.Field,
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
+		}
+	}
+	return shared.RecordHistory(ctx, l.DB, &history, details)
+}
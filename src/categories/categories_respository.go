@@ -1,6 +1,7 @@
 package categories
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -16,40 +17,164 @@ func NewCategoryRepository(db *gorm.DB) *CategoryRepository {
 	return &CategoryRepository{DB: db}
 }
 
-func (r *CategoryRepository) Create(category *Categories) error {
-	return r.DB.Create(category).Error
+// db returns the connection bound to the context, which carries the tenant the queries are scoped to
+// and the transaction of the unit of work in progress, if any
+func (r *CategoryRepository) db(ctx context.Context) *gorm.DB {
+	return shared.DB(ctx, r.DB)
 }
 
-func (r *CategoryRepository) FindAll(criteria []shared.Criterion) ([]Categories, error) {
+func (r *CategoryRepository) Create(ctx context.Context, category *Categories) error {
+	return r.db(ctx).Create(category).Error
+}
+
+// FindAll returns the categories matching the criteria and the total of matches ignoring LIMIT/OFFSET
+func (r *CategoryRepository) FindAll(ctx context.Context, criteria []shared.Criterion) ([]Categories, int64, error) {
 	var categories []Categories
-	query := r.DB.Model(&Categories{})
+	var total int64
 
-	if len(criteria) > 0 {
-		query = shared.ApplyCriteria(query, criteria)
+	countQuery, err := shared.ApplyCriteria(r.db(ctx).Model(&Categories{}), CategorySchema, shared.WithoutPagination(criteria))
+	if err != nil {
+		return nil, 0, err
 	}
 
-	err := query.Find(&categories).Error
+	if err := countQuery.Count(&total).Error; err != nil {
+		log.Printf("Error counting categories %+v: %v", criteria, err)
+		return nil, 0, fmt.Errorf("failed to count categories: %w", err)
+	}
+
+	query, err := shared.ApplyCriteria(r.db(ctx).Model(&Categories{}), CategorySchema, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Find(&categories).Error
 
 	if err != nil {
 		log.Printf("Error fetching categories %+v: %v", criteria, err)
-		return nil, fmt.Errorf("failed to fetch categories: %w", err)
+		return nil, 0, fmt.Errorf("failed to fetch categories: %w", err)
 	}
 
-	return categories, nil
+	return categories, total, nil
 }
 
-func (r *CategoryRepository) FindByID(id uint) (*Categories, error) {
+func (r *CategoryRepository) FindByID(ctx context.Context, id uint) (*Categories, error) {
 	var category Categories
-	if err := r.DB.First(&category, id).Error; err != nil {
+	if err := r.db(ctx).Scopes(shared.TenantScope("categories")).First(&category, id).Error; err != nil {
 		return nil, err
 	}
 	return &category, nil
 }
 
-func (r *CategoryRepository) Update(category *Categories) error {
-	return r.DB.Save(category).Error
+// Update saves every field of the category but its tenant, a category of another tenant is not found
+func (r *CategoryRepository) Update(ctx context.Context, category *Categories) error {
+	result := r.db(ctx).Scopes(shared.TenantScope("categories")).Select("*").Omit("TenantID").Updates(category)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *CategoryRepository) Delete(ctx context.Context, id uint) error {
+	return r.db(ctx).Scopes(shared.TenantScope("categories")).Delete(&Categories{}, id).Error
 }
 
-func (r *CategoryRepository) Delete(id uint) error {
-	return r.DB.Delete(&Categories{}, id).Error
-}
\ No newline at end of file
+func (r *CategoryRepository) FindTrashed(ctx context.Context, criteria []shared.Criterion) ([]Categories, int64, error) {
+	var categories []Categories
+	var total int64
+
+	trashed := func() *gorm.DB {
+		return r.db(ctx).Unscoped().Model(&Categories{}).Where("deleted_at IS NOT NULL")
+	}
+
+	countQuery, err := shared.ApplyCriteria(trashed(), CategorySchema, shared.WithoutPagination(criteria))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := countQuery.Count(&total).Error; err != nil {
+		log.Printf("Error counting trashed categories %+v: %v", criteria, err)
+		return nil, 0, fmt.Errorf("failed to count trashed categories: %w", err)
+	}
+
+	query, err := shared.ApplyCriteria(trashed(), CategorySchema, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Find(&categories).Error
+
+	if err != nil {
+		log.Printf("Error fetching trashed categories %+v: %v", criteria, err)
+		return nil, 0, fmt.Errorf("failed to fetch trashed categories: %w", err)
+	}
+
+	return categories, total, nil
+}
+
+func (r *CategoryRepository) FindTrashedByID(ctx context.Context, id uint) (*Categories, error) {
+	var category Categories
+	if err := r.db(ctx).Unscoped().Scopes(shared.TenantScope("categories")).Where("deleted_at IS NOT NULL").First(&category, id).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Restore takes the category out of the trash, a category of another tenant or not in the trash is not found
+func (r *CategoryRepository) Restore(ctx context.Context, id uint) error {
+	result := r.db(ctx).Unscoped().Model(&Categories{}).Scopes(shared.TenantScope("categories")).
+		Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// productCategory is the link of a category to a product seen from the categories, the products package owns the model
+type productCategory struct {
+	ProductID  uint `gorm:"primaryKey"`
+	CategoryID uint `gorm:"primaryKey"`
+	DeletedAt  gorm.DeletedAt
+}
+
+func (productCategory) TableName() string {
+	return "product_categories"
+}
+
+// Purge permanently removes a category and its links to products. The history is kept, category_histories
+// has no foreign key on the categories so it still tells what happened to the category
+func (r *CategoryRepository) Purge(ctx context.Context, id uint) error {
+	return r.db(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Scopes(shared.TenantScope("categories")).Select("id").First(&Categories{}, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("category_id = ?", id).Delete(&productCategory{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&Categories{}, id).Error
+	})
+}
+
+func (r *CategoryRepository) FindHistoryByCategoryID(ctx context.Context, categoryID uint, filter CategoryHistoryFilter) ([]CategoryHistory, error) {
+	var histories []CategoryHistory
+	query := r.db(ctx).Model(&CategoryHistory{}).Scopes(shared.TenantScope("category_histories")).Where("category_id = ?", categoryID).Preload("Details")
+	if filter.Start != nil {
+		query = query.Where("changed_at >= ?", *filter.Start)
+	}
+	if filter.End != nil {
+		query = query.Where("changed_at <= ?", *filter.End)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.ActorType != "" {
+		query = query.Where("actor_type = ?", filter.ActorType)
+	}
+	err := query.Order("changed_at DESC").Find(&histories).Error
+	return histories, err
+}
@@ -0,0 +1,132 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/Javieradel/api-qisur.git/src/shared/sqltest"
+	"gorm.io/gorm"
+)
+
+const (
+	tenantA uint = 7
+	tenantB uint = 8
+)
+
+// categoryOfTenantB is the ID of a category owned by tenant B, the fake database finds no row for it
+// when the queries are restricted to tenant A
+const categoryOfTenantB uint = 42
+
+// tenantStatements returns the statements reading or writing the categories table
+func tenantStatements(fake *sqltest.DB) []sqltest.Statement {
+	var statements []sqltest.Statement
+	for _, statement := range fake.Statements() {
+		if strings.Contains(statement.SQL, `FROM "categories"`) || strings.Contains(statement.SQL, `UPDATE "categories"`) {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+var repositoryCalls = []struct {
+	name string
+	run  func(ctx context.Context, repo *CategoryRepository, id uint) error
+}{
+	{"FindByID", func(ctx context.Context, repo *CategoryRepository, id uint) error {
+		_, err := repo.FindByID(ctx, id)
+		return err
+	}},
+	{"FindAll", func(ctx context.Context, repo *CategoryRepository, _ uint) error {
+		_, _, err := repo.FindAll(ctx, []shared.Criterion{{Operator: shared.OpLimit, Value: 10}})
+		return err
+	}},
+	{"Update", func(ctx context.Context, repo *CategoryRepository, id uint) error {
+		return repo.Update(ctx, &Categories{ID: id, TenantID: tenantB, Name: "taken over"})
+	}},
+	{"Delete", func(ctx context.Context, repo *CategoryRepository, id uint) error {
+		return repo.Delete(ctx, id)
+	}},
+	{"Restore", func(ctx context.Context, repo *CategoryRepository, id uint) error {
+		return repo.Restore(ctx, id)
+	}},
+	{"Purge", func(ctx context.Context, repo *CategoryRepository, id uint) error {
+		return repo.Purge(ctx, id)
+	}},
+}
+
+func TestCategoryRepositoryIsolatesTenants(t *testing.T) {
+	for _, call := range repositoryCalls {
+		t.Run(call.name, func(t *testing.T) {
+			db, fake := sqltest.Open()
+			fake.Affect(`UPDATE "categories"`, 0)
+			err := call.run(shared.WithTenant(context.Background(), tenantA), NewCategoryRepository(db), categoryOfTenantB)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatal(err)
+			}
+
+			statements := tenantStatements(fake)
+			if len(statements) == 0 {
+				t.Fatal("no statement on categories")
+			}
+			for _, statement := range statements {
+				if !statement.Compares(`"categories"."tenant_id"`, int64(tenantA)) {
+					t.Errorf("not restricted to tenant A: %s %v", statement.SQL, statement.Args)
+				}
+				if strings.Contains(statement.SQL, `"tenant_id"=`) {
+					t.Errorf("tenant changed: %s %v", statement.SQL, statement.Args)
+				}
+			}
+			if fake.Ran("INSERT") || fake.Ran("DELETE") {
+				t.Errorf("the category of tenant B was written: %v", fake.Statements())
+			}
+		})
+	}
+}
+
+func TestCategoryRepositoryRestoreOfAnotherTenantIsNotFound(t *testing.T) {
+	db, fake := sqltest.Open()
+	fake.Affect(`UPDATE "categories"`, 0)
+
+	err := NewCategoryRepository(db).Restore(shared.WithTenant(context.Background(), tenantA), categoryOfTenantB)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("error = %v, want gorm.ErrRecordNotFound", err)
+	}
+	if restore := fake.Matching(`UPDATE "categories"`); len(restore) != 1 || !strings.Contains(restore[0].SQL, "deleted_at IS NOT NULL") {
+		t.Fatalf("restored %v, want only a category in the trash", restore)
+	}
+}
+
+func TestCategoryRepositoryPurgesOnlyCategoriesOfTheTenant(t *testing.T) {
+	db, fake := sqltest.Open()
+	fake.Return(`SELECT "id" FROM "categories"`, []string{"id"}, []any{int64(1)})
+
+	if err := NewCategoryRepository(db).Purge(shared.WithTenant(context.Background(), tenantA), 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, fragment := range []string{`DELETE FROM "product_categories"`, `DELETE FROM "categories"`} {
+		if !fake.Ran(fragment) {
+			t.Errorf("%s not run", fragment)
+		}
+	}
+	if fake.Ran(`DELETE FROM "category_history`) {
+		t.Errorf("the history was deleted: %v", fake.Statements())
+	}
+}
+
+func TestCategoryRepositoryRequiresTenant(t *testing.T) {
+	for _, call := range repositoryCalls {
+		t.Run(call.name, func(t *testing.T) {
+			db, fake := sqltest.Open()
+			err := call.run(context.Background(), NewCategoryRepository(db), 1)
+			if !errors.Is(err, shared.ErrTenantRequired) {
+				t.Fatalf("error = %v, want shared.ErrTenantRequired", err)
+			}
+			if statements := tenantStatements(fake); len(statements) > 0 || fake.Ran("INSERT") {
+				t.Fatalf("ran without a tenant: %v", fake.Statements())
+			}
+		})
+	}
+}
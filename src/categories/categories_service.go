@@ -1,35 +1,101 @@
 package categories
 
 import (
+	"context"
+
 	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
 )
 
 type CategoryService struct {
-	repo *CategoryRepository
+	repo       *CategoryRepository
+	unitOfWork *shared.UnitOfWork
+	eventBus   *shared.EventBus
 }
 
-func NewCategoryService(repo *CategoryRepository) *CategoryService {
-	return &CategoryService{repo: repo}
+func NewCategoryService(repo *CategoryRepository, unitOfWork *shared.UnitOfWork, eventBus *shared.EventBus) *CategoryService {
+	return &CategoryService{repo: repo, unitOfWork: unitOfWork, eventBus: eventBus}
 }
 
-func (s *CategoryService) FindAll(filters []shared.Criterion) ([]Categories, error) {
-	return s.repo.FindAll(filters)
+func (s *CategoryService) FindAll(ctx context.Context, filters []shared.Criterion) ([]Categories, int64, error) {
+	return s.repo.FindAll(ctx, filters)
 }
 
-func (s *CategoryService) FindByID(id uint) (*Categories, error) {
-	return s.repo.FindByID(id)
+func (s *CategoryService) FindByID(ctx context.Context, id uint) (*Categories, error) {
+	return s.repo.FindByID(ctx, id)
 }
 
-func (s *CategoryService) Create(category *Categories) error {
+// Create stores the category and its history in a single transaction
+func (s *CategoryService) Create(ctx context.Context, category *Categories) error {
 	//TODO add bussines validations
-	return s.repo.Create(category)
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, category); err != nil {
+			return err
+		}
+		return s.eventBus.PublishTx(ctx, CategoryCreatedEvent{EventMeta: shared.NewEventMeta(), Category: *category, Actor: shared.ActorFrom(ctx)})
+	})
 }
 
-func (s *CategoryService) Update(category *Categories) error {
+// Update stores the category and its history in a single transaction
+func (s *CategoryService) Update(ctx context.Context, category *Categories) error {
 	//TODO add bussines validations
-	return s.repo.Update(category)
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		oldCategory, err := s.repo.FindByID(ctx, category.ID)
+		if err != nil {
+			return err
+		}
+		category.TenantID = oldCategory.TenantID
+		if err := s.repo.Update(ctx, category); err != nil {
+			return err
+		}
+		return s.eventBus.PublishTx(ctx, CategoryUpdatedEvent{EventMeta: shared.NewEventMeta(), OldCategory: *oldCategory, NewCategory: *category, Actor: shared.ActorFrom(ctx)})
+	})
+}
+
+func (s *CategoryService) Delete(ctx context.Context, id uint) error {
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		tenantID, _ := shared.TenantFrom(ctx)
+		return s.eventBus.PublishTx(ctx, CategoryDeletedEvent{EventMeta: shared.NewEventMeta(), CategoryID: id, TenantID: tenantID, Actor: shared.ActorFrom(ctx)})
+	})
+}
+
+func (s *CategoryService) FindTrashed(ctx context.Context, filters []shared.Criterion) ([]Categories, int64, error) {
+	return s.repo.FindTrashed(ctx, filters)
+}
+
+func (s *CategoryService) FindTrashedByID(ctx context.Context, id uint) (*Categories, error) {
+	return s.repo.FindTrashedByID(ctx, id)
+}
+
+func (s *CategoryService) Restore(ctx context.Context, id uint) error {
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		category, err := s.repo.FindTrashedByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+		deletedAt := category.DeletedAt.Time
+		category.DeletedAt = gorm.DeletedAt{}
+		return s.eventBus.PublishTx(ctx, CategoryRestoredEvent{EventMeta: shared.NewEventMeta(), Category: *category, DeletedAt: deletedAt, Actor: shared.ActorFrom(ctx)})
+	})
 }
 
-func (s *CategoryService) Delete(id uint) error {
-	return s.repo.Delete(id)
-}
\ No newline at end of file
+// Purge permanently removes the category, its history is kept and ends with the purge
+func (s *CategoryService) Purge(ctx context.Context, id uint) error {
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Purge(ctx, id); err != nil {
+			return err
+		}
+		tenantID, _ := shared.TenantFrom(ctx)
+		return s.eventBus.PublishTx(ctx, CategoryPurgedEvent{EventMeta: shared.NewEventMeta(), CategoryID: id, TenantID: tenantID, Actor: shared.ActorFrom(ctx)})
+	})
+}
+
+func (s *CategoryService) FindHistoryByCategoryID(ctx context.Context, categoryID uint, filter CategoryHistoryFilter) ([]CategoryHistory, error) {
+	return s.repo.FindHistoryByCategoryID(ctx, categoryID, filter)
+}
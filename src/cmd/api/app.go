@@ -4,10 +4,16 @@ import (
 	"log"
 
 	_ "github.com/Javieradel/api-qisur.git/docs"
+	"github.com/Javieradel/api-qisur.git/src/auth"
 	"github.com/Javieradel/api-qisur.git/src/categories"
 	"github.com/Javieradel/api-qisur.git/src/db"
+	"github.com/Javieradel/api-qisur.git/src/outbox"
 	"github.com/Javieradel/api-qisur.git/src/products"
+	"github.com/Javieradel/api-qisur.git/src/realtime"
 	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/Javieradel/api-qisur.git/src/suggest"
+	"github.com/Javieradel/api-qisur.git/src/tenants"
+	"github.com/Javieradel/api-qisur.git/src/webhooks"
 	swaggo "github.com/gofiber/contrib/v3/swaggo"
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/cors"
@@ -18,21 +24,86 @@ import (
 // @description     Example API with Fiber and Swagger.
 // @host            localhost:3000
 // @BasePath        /api/v1
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token from /auth/login as "Bearer <token>"
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name Authorization
+// @description API key from /api-keys as "ApiKey <key>"
 // ? Swagger retrieve 302 code status??
 func main() {
 	db.InitDB()
+	authConfig, err := auth.LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid auth configuration: %v", err)
+	}
+
+	if _, err := tenants.Migrate(db.DB, "products", "categories", "product_categories", "product_histories"); err != nil {
+		log.Fatalf("Failed to migrate tenants: %v", err)
+	}
+	if err := shared.MigrateHistoryValues(db.DB, "product_history_details", "category_history_details"); err != nil {
+		log.Fatalf("Failed to migrate history values: %v", err)
+	}
+	if err := products.SetupJoinTables(db.DB); err != nil {
+		log.Fatalf("Failed to set up join tables: %v", err)
+	}
 	db.DB.AutoMigrate(&products.Product{}, &categories.Categories{}, &products.ProductCategories{}, &products.ProductHistory{}, &products.ProductHistoryDetail{})
+	db.DB.AutoMigrate(&categories.CategoryHistory{}, &categories.CategoryHistoryDetail{})
+	db.DB.AutoMigrate(&auth.User{}, &auth.UserRole{}, &auth.RefreshToken{}, &auth.RevokedAccessToken{}, &auth.APIKey{})
+	db.DB.AutoMigrate(&realtime.EventLog{}, &webhooks.Webhook{}, &webhooks.WebhookDelivery{})
+	db.DB.AutoMigrate(&outbox.Message{}, &outbox.Delivery{})
+	if err := products.MigrateSearch(db.DB, products.SearchLanguage()); err != nil {
+		log.Fatalf("Failed to migrate product search: %v", err)
+	}
+	if err := suggest.Migrate(db.DB); err != nil {
+		log.Fatalf("Failed to migrate suggestions: %v", err)
+	}
 
 	eventBus := shared.NewEventBus()
 	productHistoryListener := products.NewProductHistoryListener(db.DB)
-	eventBus.Subscribe("product.created", productHistoryListener)
-	eventBus.Subscribe("product.updated", productHistoryListener)
+	eventBus.SubscribeTx("product.created", productHistoryListener)
+	eventBus.SubscribeTx("product.updated", productHistoryListener)
+	eventBus.SubscribeTx("product.categories_updated", productHistoryListener)
+	eventBus.SubscribeTx("product.deleted", productHistoryListener)
+	eventBus.SubscribeTx("product.restored", productHistoryListener)
+	eventBus.SubscribeTx("product.purged", productHistoryListener)
+	categoryHistoryListener := categories.NewCategoryHistoryListener(db.DB)
+	eventBus.SubscribeTx("category.created", categoryHistoryListener)
+	eventBus.SubscribeTx("category.updated", categoryHistoryListener)
+	eventBus.SubscribeTx("category.deleted", categoryHistoryListener)
+	eventBus.SubscribeTx("category.restored", categoryHistoryListener)
+	eventBus.SubscribeTx("category.purged", categoryHistoryListener)
+	hub := realtime.NewHub()
+	hub.Listen(eventBus)
+	eventStream := realtime.NewStream(realtime.NewEventLogRepository(db.DB))
+	eventStream.Listen(eventBus)
+	eventStream.StartPruning(realtime.EventLogRetention())
+	webhookRepo := webhooks.NewWebhookRepository(db.DB)
+	webhookDispatcher := webhooks.NewDispatcher(webhookRepo)
+	webhookDispatcher.Start()
+	webhookService := webhooks.NewWebhookService(webhookRepo, webhookDispatcher)
+	webhooks.NewWebhookListener(webhookService).Listen(eventBus)
+	outboxRepo := outbox.NewRepository(db.DB)
+	outboxDispatcher := outbox.NewDispatcher(outboxRepo, eventBus)
+	outboxDispatcher.Start()
+	outboxDispatcher.StartPruning(outbox.Retention())
+	eventBus.UseStore(outbox.NewOutbox(outboxRepo, outboxDispatcher))
 
 	//TODO add a container to DI
+	unitOfWork := shared.NewUnitOfWork(db.DB)
 	productRepo := products.NewProductRepository(db.DB)
-	productService := products.NewProductService(productRepo, eventBus)
+	productService := products.NewProductService(productRepo, unitOfWork, eventBus)
 	categoryRepo := categories.NewCategoryRepository(db.DB)
-	categoryService := categories.NewCategoryService(categoryRepo)
+	categoryService := categories.NewCategoryService(categoryRepo, unitOfWork, eventBus)
+	suggestRepo := suggest.NewSuggestRepository(db.DB)
+	suggestService := suggest.NewSuggestService(suggestRepo)
+	authRepo := auth.NewAuthRepository(db.DB)
+	authService := auth.NewAuthService(authRepo, authConfig)
+	apiKeyRepo := auth.NewAPIKeyRepository(db.DB)
+	apiKeyService := auth.NewAPIKeyService(apiKeyRepo)
+	tenantRepo := tenants.NewTenantRepository(db.DB)
 
 	app := fiber.New()
 
@@ -47,10 +118,25 @@ func main() {
 	})
 
 	validator := shared.NewValidator()
+	guard := shared.RouteGuard{
+		Authenticate: auth.NewAuthMiddleware(authService, apiKeyService),
+		Authorize:    auth.Authorize,
+		Tenant:       tenants.NewTenantMiddleware(tenantRepo),
+	}
+	authController := auth.NewAuthController(authService, validator)
+	authController.RegisterRoutes(app, guard)
+	apiKeyController := auth.NewAPIKeyController(apiKeyService, validator)
+	apiKeyController.RegisterRoutes(app, guard)
 	productController := products.NewProductController(productService, validator)
-	productController.RegisterRoutes(app)
+	productController.RegisterRoutes(app, guard)
 	categoryController := categories.NewCategoryController(categoryService)
-	categoryController.RegisterRoutes(app)
+	categoryController.RegisterRoutes(app, guard)
+	suggestController := suggest.NewSuggestController(suggestService, validator)
+	suggestController.RegisterRoutes(app, guard)
+	realtimeController := realtime.NewRealtimeController(hub, eventStream)
+	realtimeController.RegisterRoutes(app, guard)
+	webhookController := webhooks.NewWebhookController(webhookService, validator)
+	webhookController.RegisterRoutes(app, guard)
 
 	log.Fatal(app.Listen(":3000"))
 }
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/Javieradel/api-qisur.git/src/db"
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/Javieradel/api-qisur.git/src/tenants"
 	"gorm.io/gorm"
 )
 
@@ -18,18 +21,28 @@ var seeds []Seed
 func registerSeeds() {
 	seeds = append(seeds, ProductsSeed)
 	seeds = append(seeds, CategoriesSeed)
+	seeds = append(seeds, UsersSeed)
 }
 
 func main() {
 	db.InitDB()
 	registerSeeds()
+
+	// the seeded catalog belongs to the default tenant
+	tenant, err := tenants.EnsureDefault(db.DB)
+	if err != nil {
+		fmt.Printf("Error resolving the default tenant: %v\n", err)
+		return
+	}
+	conn := db.DB.WithContext(shared.WithTenant(context.Background(), tenant.ID))
+
 	if len(os.Args) > 1 {
 		seedName := os.Args[1]
 		found := false
 		for _, seed := range seeds {
 			if seed.Name == seedName {
 				fmt.Printf("Running seed: %s\n", seed.Name)
-				if err := seed.Run(db.DB); err != nil {
+				if err := seed.Run(conn); err != nil {
 					fmt.Printf("Error running seed %s: %v\n", seed.Name, err)
 				}
 				found = true
@@ -46,7 +59,7 @@ func main() {
 
 	for _, seed := range seeds {
 		fmt.Printf("Running seed: %s\n", seed.Name)
-		if err := seed.Run(db.DB); err != nil {
+		if err := seed.Run(conn); err != nil {
 			fmt.Printf("Error running seed %s: %v\n", seed.Name, err)
 		}
 	}
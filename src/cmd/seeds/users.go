@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Javieradel/api-qisur.git/src/auth"
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
+)
+
+// UsersSeed creates the initial admin user of the seeded tenant from SEED_ADMIN_EMAIL and SEED_ADMIN_PASSWORD
+var UsersSeed = Seed{
+	Name: "users",
+	Run: func(db *gorm.DB) error {
+		email := os.Getenv("SEED_ADMIN_EMAIL")
+		password := os.Getenv("SEED_ADMIN_PASSWORD")
+		if email == "" || password == "" {
+			return errors.New("SEED_ADMIN_EMAIL and SEED_ADMIN_PASSWORD are required")
+		}
+
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+
+		user := auth.User{Email: email, Name: "Admin", PasswordHash: hash}
+		if tenantID, ok := shared.TenantFrom(db.Statement.Context); ok {
+			user.TenantID = &tenantID
+		}
+		if err := db.Where(auth.User{Email: email}).FirstOrCreate(&user).Error; err != nil {
+			return fmt.Errorf("failed to create user %s: %w", email, err)
+		}
+
+		role := auth.UserRole{UserID: user.ID, Role: auth.RoleAdmin}
+		if err := db.Where(role).FirstOrCreate(&role).Error; err != nil {
+			return fmt.Errorf("failed to assign admin role to %s: %w", email, err)
+		}
+
+		fmt.Printf("User %s seeded successfully!\n", email)
+		return nil
+	},
+}
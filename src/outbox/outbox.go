@@ -0,0 +1,103 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/google/uuid"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+
+	defaultRetention = 7 * 24 * time.Hour
+)
+
+// Message is an event written in the transaction of the change that raised it, the dispatcher delivers it
+// to the event bus listeners once committed
+type Message struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	// EventID is the idempotency key of the event, the listeners discard the events handed again with it
+	EventID  uuid.UUID `gorm:"type:uuid;uniqueIndex;not null"`
+	Topic    string    `gorm:"index;not null"`
+	TenantID uint      `gorm:"index"`
+	// Payload is the JSON of the event, decoded with the type registered for the topic
+	Payload       string     `gorm:"type:jsonb;not null"`
+	Status        string     `gorm:"index;not null"`
+	Attempts      int        `gorm:"not null"`
+	NextAttemptAt *time.Time `gorm:"index"`
+	DeliveredAt   *time.Time
+	Error         string
+}
+
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// Delivery records a listener that handled a message, so the message is only delivered again to the others
+type Delivery struct {
+	MessageID   uint   `gorm:"primaryKey"`
+	Listener    string `gorm:"primaryKey"`
+	DeliveredAt time.Time
+}
+
+func (Delivery) TableName() string {
+	return "outbox_deliveries"
+}
+
+// Outbox is the event store of the event bus, it appends the events to the unit of work of the context
+type Outbox struct {
+	repo       *Repository
+	dispatcher *Dispatcher
+}
+
+func NewOutbox(repo *Repository, dispatcher *Dispatcher) *Outbox {
+	return &Outbox{repo: repo, dispatcher: dispatcher}
+}
+
+// Append writes the event in the unit of work of the context and wakes the dispatcher up once it commits.
+// Only the registered events embedding shared.EventMeta can be appended
+func (o *Outbox) Append(ctx context.Context, event shared.Event) error {
+	identified, ok := event.(shared.IdentifiedEvent)
+	if !ok || identified.EventID() == uuid.Nil {
+		return fmt.Errorf("%s: %w", event.Topic(), shared.ErrEventWithoutID)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding %s event: %w", event.Topic(), err)
+	}
+
+	occurredAt := identified.EventTime()
+	message := Message{
+		EventID:       identified.EventID(),
+		Topic:         event.Topic(),
+		Payload:       string(payload),
+		Status:        StatusPending,
+		NextAttemptAt: &occurredAt,
+	}
+	if tenantEvent, ok := event.(shared.TenantEvent); ok {
+		message.TenantID = tenantEvent.Tenant()
+	}
+	if err := o.repo.Create(ctx, &message); err != nil {
+		return err
+	}
+
+	shared.AfterCommit(ctx, o.dispatcher.Wake)
+	return nil
+}
+
+// Retention returns how long the delivered messages are kept, set in OUTBOX_RETENTION and a week by default
+func Retention() time.Duration {
+	retention, err := time.ParseDuration(os.Getenv("OUTBOX_RETENTION"))
+	if err != nil || retention <= 0 {
+		return defaultRetention
+	}
+	return retention
+}
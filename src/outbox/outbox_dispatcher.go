@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"log"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+const (
+	// MaxAttempts is the number of attempts before a message is given up
+	MaxAttempts = 10
+
+	retryBase    = 5 * time.Second
+	retryMax     = time.Hour
+	pollInterval = 2 * time.Second
+	claimLease   = time.Minute
+	claimBatch   = 100
+)
+
+// Dispatcher delivers the committed messages to the event bus listeners at least once: the listeners that handled
+// a message are recorded, and a failing listener gets the message again later without the others getting it twice.
+// A message is marked delivered once every listener handled it
+type Dispatcher struct {
+	repo *Repository
+	bus  *shared.EventBus
+	wake chan struct{}
+	now  func() time.Time
+}
+
+func NewDispatcher(repo *Repository, bus *shared.EventBus) *Dispatcher {
+	return &Dispatcher{repo: repo, bus: bus, wake: make(chan struct{}, 1), now: time.Now}
+}
+
+// Start delivers the due messages in the background, when woken up and every poll interval for the retries
+// and the messages left behind by other instances
+func (d *Dispatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			d.dispatchDue()
+			select {
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// Wake makes the dispatcher look for due messages without waiting for the next poll
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// StartPruning deletes every hour the messages delivered before the retention
+func (d *Dispatcher) StartPruning(retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			if _, err := d.repo.Prune(d.now().Add(-retention)); err != nil {
+				log.Printf("Error pruning the outbox: %v", err)
+			}
+		}
+	}()
+}
+
+func (d *Dispatcher) dispatchDue() {
+	for {
+		messages, err := d.repo.ClaimDue(d.now(), claimLease, claimBatch)
+		if err != nil {
+			log.Printf("Error claiming outbox messages: %v", err)
+			return
+		}
+
+		for i := range messages {
+			d.deliver(&messages[i])
+		}
+
+		if len(messages) < claimBatch {
+			return
+		}
+	}
+}
+
+// deliver hands the message to the listeners that did not handle it yet and schedules the next attempt
+// when one of them fails, a message that can't be decoded is given up right away
+func (d *Dispatcher) deliver(message *Message) {
+	message.Attempts++
+	event, err := shared.DecodeEvent(message.Topic, []byte(message.Payload))
+	if err != nil {
+		log.Printf("Error decoding outbox message %d (%s): %v", message.ID, message.Topic, err)
+		message.Status = StatusFailed
+		message.NextAttemptAt = nil
+		message.Error = err.Error()
+		d.save(message, nil)
+		return
+	}
+
+	delivered, err := d.repo.FindDelivered(message.ID)
+	if err != nil {
+		// the claim lease expires and the message is delivered again then
+		log.Printf("Error finding the deliveries of outbox message %d: %v", message.ID, err)
+		return
+	}
+
+	handled, err := d.bus.Deliver(event, delivered)
+	now := d.now()
+	switch {
+	case err == nil:
+		message.Status = StatusDelivered
+		message.NextAttemptAt = nil
+		message.DeliveredAt = &now
+		message.Error = ""
+	case message.Attempts >= MaxAttempts:
+		message.Status = StatusFailed
+		message.NextAttemptAt = nil
+		message.Error = err.Error()
+	default:
+		next := now.Add(Backoff(message.Attempts))
+		message.NextAttemptAt = &next
+		message.Error = err.Error()
+	}
+	if err != nil {
+		log.Printf("Error delivering outbox message %d (%s): %v", message.ID, message.Topic, err)
+	}
+	d.save(message, handled)
+}
+
+func (d *Dispatcher) save(message *Message, handled []string) {
+	if err := d.repo.SaveAttempt(message, handled, d.now()); err != nil {
+		log.Printf("Error saving outbox message %d: %v", message.ID, err)
+	}
+}
+
+// Backoff is the delay before the next attempt, doubling from 5 seconds up to an hour
+func Backoff(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMax {
+			return retryMax
+		}
+	}
+	return delay
+}
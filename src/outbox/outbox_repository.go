@@ -0,0 +1,92 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	DB *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{DB: db}
+}
+
+// Create writes the message in the transaction of the unit of work of the context, if any
+func (r *Repository) Create(ctx context.Context, message *Message) error {
+	return shared.DB(ctx, r.DB).Create(message).Error
+}
+
+// ClaimDue returns the pending messages due by now, oldest first, and pushes back their next attempt by the lease
+// so other dispatchers skip them while they are delivered
+func (r *Repository) ClaimDue(now time.Time, lease time.Duration, limit int) ([]Message, error) {
+	var messages []Message
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+			Order("id").
+			Limit(limit).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(messages))
+		for i, message := range messages {
+			ids[i] = message.ID
+		}
+		return tx.Model(&Message{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return messages, err
+}
+
+// FindDelivered returns the names of the listeners that handled the message
+func (r *Repository) FindDelivered(messageID uint) (map[string]bool, error) {
+	var listeners []string
+	if err := r.DB.Model(&Delivery{}).Where("message_id = ?", messageID).Pluck("listener", &listeners).Error; err != nil {
+		return nil, err
+	}
+	delivered := make(map[string]bool, len(listeners))
+	for _, listener := range listeners {
+		delivered[listener] = true
+	}
+	return delivered, nil
+}
+
+// SaveAttempt records the outcome of a delivery attempt along with the listeners that handled the message
+func (r *Repository) SaveAttempt(message *Message, listeners []string, at time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if len(listeners) > 0 {
+			deliveries := make([]Delivery, len(listeners))
+			for i, listener := range listeners {
+				deliveries[i] = Delivery{MessageID: message.ID, Listener: listener, DeliveredAt: at}
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(message).
+			Select("status", "attempts", "next_attempt_at", "delivered_at", "error").
+			Updates(message).Error
+	})
+}
+
+// Prune deletes the messages delivered before the given time along with their deliveries
+func (r *Repository) Prune(before time.Time) (int64, error) {
+	var pruned int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		messageIDs := tx.Model(&Message{}).Select("id").Where("status = ? AND delivered_at < ?", StatusDelivered, before)
+		if err := tx.Where("message_id IN (?)", messageIDs).Delete(&Delivery{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("status = ? AND delivered_at < ?", StatusDelivered, before).Delete(&Message{})
+		pruned = result.RowsAffected
+		return result.Error
+	})
+	return pruned, err
+}
@@ -4,22 +4,90 @@ import (
 	"time"
 
 	"github.com/Javieradel/api-qisur.git/src/categories"
+	"github.com/Javieradel/api-qisur.git/src/shared"
 	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
+// Product is recorded in the product history field by field, the history tag leaves out the bookkeeping
+// fields and the categories, whose changes are recorded on their own
 type Product struct {
-	ID          uint `gorm:"primarykey"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	DeletedAt   *time.Time `gorm:"index"`
+	ID          uint           `gorm:"primarykey" history:"-"`
+	CreatedAt   time.Time      `history:"-"`
+	UpdatedAt   time.Time      `history:"-"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" history:"-"`
+	TenantID    uint           `gorm:"index;not null" history:"-"`
 	Name        string
 	Description string
 	Price       decimal.Decimal `gorm:"type:decimal(10,2)"`
 	Stock       int
-	Categories  []categories.Categories `gorm:"many2many:product_categories;joinForeignKey:ProductID;joinReferences:CategoryID"`
+	Categories  []categories.Categories `gorm:"many2many:product_categories;joinForeignKey:ProductID;joinReferences:CategoryID" history:"-"`
+}
+
+func (p *Product) BeforeCreate(tx *gorm.DB) error {
+	return shared.AssignTenant(tx, &p.TenantID)
 }
 
 // TableName overrides the table name used by Product to `products`
 func (Product) TableName() string {
 	return "products"
 }
+
+// ProductSchema whitelists the product fields usable to filter and sort listings
+var ProductSchema = shared.RegisterSchema(shared.Schema{
+	Table:    "products",
+	Tenanted: true,
+	Fields: map[string]shared.Field{
+		"id": {
+			Column:    "id",
+			Type:      shared.FieldInteger,
+			Operators: []shared.Operator{shared.OpEq, shared.OpIn, shared.OpNot},
+			Sortable:  true,
+		},
+		"name": {
+			Column:    "name",
+			Type:      shared.FieldString,
+			Operators: []shared.Operator{shared.OpEq, shared.OpLike, shared.OpILike, shared.OpIn, shared.OpNot},
+			Sortable:  true,
+		},
+		"description": {
+			Column:    "description",
+			Type:      shared.FieldString,
+			Operators: []shared.Operator{shared.OpEq, shared.OpLike, shared.OpILike, shared.OpNot, shared.OpIsNull},
+		},
+		"price": {
+			Column:    "price",
+			Type:      shared.FieldNumber,
+			Operators: []shared.Operator{shared.OpEq, shared.OpGt, shared.OpGte, shared.OpLt, shared.OpLte, shared.OpNot, shared.OpIn, shared.OpBetween},
+			Sortable:  true,
+		},
+		"stock": {
+			Column:    "stock",
+			Type:      shared.FieldInteger,
+			Operators: []shared.Operator{shared.OpEq, shared.OpGt, shared.OpGte, shared.OpLt, shared.OpLte, shared.OpNot, shared.OpIn, shared.OpBetween},
+			Sortable:  true,
+		},
+		"created_at": {
+			Column:    "created_at",
+			Type:      shared.FieldTime,
+			Operators: []shared.Operator{shared.OpGt, shared.OpGte, shared.OpLt, shared.OpLte, shared.OpBetween},
+			Sortable:  true,
+		},
+		"updated_at": {
+			Column:    "updated_at",
+			Type:      shared.FieldTime,
+			Operators: []shared.Operator{shared.OpGt, shared.OpGte, shared.OpLt, shared.OpLte, shared.OpBetween},
+			Sortable:  true,
+		},
+		"categories": {
+			Type:      shared.FieldInteger,
+			Operators: []shared.Operator{shared.OpIn, shared.OpAll, shared.OpNone},
+			Membership: &shared.Membership{
+				Table:      "product_categories",
+				LocalKey:   "id",
+				OwnerKey:   "product_id",
+				ForeignKey: "category_id",
+			},
+		},
+	},
+})
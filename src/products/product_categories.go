@@ -3,6 +3,7 @@ package products
 import (
 	"time"
 
+	"github.com/Javieradel/api-qisur.git/src/shared"
 	"gorm.io/gorm"
 )
 
@@ -12,8 +13,19 @@ type ProductCategories struct {
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 	DeletedAt  gorm.DeletedAt `gorm:"index"`
+	TenantID   uint           `gorm:"index;not null"`
+}
+
+func (pc *ProductCategories) BeforeCreate(tx *gorm.DB) error {
+	return shared.AssignTenant(tx, &pc.TenantID)
 }
 
 func (ProductCategories) TableName() string {
 	return "product_categories"
-}
\ No newline at end of file
+}
+
+// SetupJoinTables makes the categories of the products go through ProductCategories,
+// so the links unlinked with a soft delete are left out when preloading them
+func SetupJoinTables(db *gorm.DB) error {
+	return db.SetupJoinTable(&Product{}, "Categories", &ProductCategories{})
+}
@@ -1,12 +1,14 @@
 package products
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"time"
 
 	"github.com/Javieradel/api-qisur.git/src/shared"
 	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -22,14 +24,27 @@ func NewProductController(service *ProductService, validator *shared.XValidator)
 	}
 }
 
-func (pc *ProductController) RegisterRoutes(app *fiber.App) {
-	app.Get("/api/v1/products", pc.GetProducts)
-	app.Get("/api/v1/products/:id", pc.GetProductByID)
-	app.Post("/api/v1/products", pc.CreateProduct)
-	app.Put("/api/v1/products/:id", pc.UpdateProduct)
-	app.Patch("/api/v1/products/:id", pc.PatchProduct)
-	app.Delete("/api/v1/products/:id", pc.DeleteProduct)
-	app.Get("/api/v1/products/:id/history", pc.GetProductHistory)
+// Routes declares the product endpoints and the permission each one requires
+func (pc *ProductController) Routes() []shared.Route {
+	return []shared.Route{
+		{Method: fiber.MethodGet, Path: "/api/v1/products", Handler: pc.GetProducts, Permission: shared.PermProductsRead},
+		{Method: fiber.MethodGet, Path: "/api/v1/products/trash", Handler: pc.GetTrashedProducts, Permission: shared.PermProductsDelete},
+		{Method: fiber.MethodGet, Path: "/api/v1/products/search", Handler: pc.SearchProducts, Permission: shared.PermProductsRead},
+		{Method: fiber.MethodGet, Path: "/api/v1/products/:id", Handler: pc.GetProductByID, Permission: shared.PermProductsRead},
+		{Method: fiber.MethodPost, Path: "/api/v1/products", Handler: pc.CreateProduct, Permission: shared.PermProductsWrite},
+		{Method: fiber.MethodPut, Path: "/api/v1/products/:id", Handler: pc.UpdateProduct, Permission: shared.PermProductsWrite},
+		{Method: fiber.MethodPatch, Path: "/api/v1/products/:id", Handler: pc.PatchProduct, Permission: shared.PermProductsWrite},
+		{Method: fiber.MethodDelete, Path: "/api/v1/products/:id", Handler: pc.DeleteProduct, Permission: shared.PermProductsDelete},
+		{Method: fiber.MethodPost, Path: "/api/v1/products/:id/restore", Handler: pc.RestoreProduct, Permission: shared.PermProductsDelete},
+		{Method: fiber.MethodDelete, Path: "/api/v1/products/:id/purge", Handler: pc.PurgeProduct, Permission: shared.PermProductsPurge},
+		{Method: fiber.MethodGet, Path: "/api/v1/products/:id/history", Handler: pc.GetProductHistory, Permission: shared.PermHistoryRead},
+		{Method: fiber.MethodGet, Path: "/api/v1/products/:id/history/:historyUUID/patch", Handler: pc.GetProductHistoryPatch, Permission: shared.PermHistoryRead},
+		{Method: fiber.MethodPost, Path: "/api/v1/products/:id/history/:historyUUID/revert", Handler: pc.RevertProduct, Permission: shared.PermProductsWrite},
+	}
+}
+
+func (pc *ProductController) RegisterRoutes(app *fiber.App, guard shared.RouteGuard) {
+	shared.RegisterTenantRoutes(app, guard, pc.Routes())
 }
 
 // @Summary Get all products
@@ -37,16 +52,28 @@ func (pc *ProductController) RegisterRoutes(app *fiber.App) {
 // @Tags products
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Number of items per page" default(10)
+// @Param cursor query string false "Opaque cursor from next_cursor to read the following rows (keyset pagination)"
+// @Param sort query string false "Comma separated fields to sort by, prefix with - for descending (e.g. -price,name)"
+// @Param filter query string false "Generic filters as filter[field][op]=value, filter[not][field][op]=value or filter[or][group][field][op]=value (ops: eq, ne, gt, gte, lt, lte, in, like, ilike, null, between)"
 // @Param name query string false "Filter by product name (partial match)"
 // @Param description query string false "Filter by product description (partial match)"
 // @Param price_from query number false "Filter by minimum price"
 // @Param price_to query number false "Filter by maximum price"
 // @Param stock query int false "Filter by minimum stock"
+// @Param categories_id query []int false "Filter by category IDs" collectionFormat(multi)
+// @Param categories_match query string false "Match any, all or none of categories_id" Enums(any, all, none) default(any)
+// @Param facets query bool false "Include category, price and stock facet counts for the current filters"
+// @Param as_of query string false "List the catalog as it was at this RFC 3339 time (e.g. 2026-05-01T10:00:00Z), only along with page and limit"
 // @Success 200 {object} shared.PaginatedResponse{data=[]Product} "OK with paginated products"
 // @Failure 400 {object} shared.Response "Invalid query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Products not found"
+// @Failure 422 {object} shared.Response "Validation failed"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /products [get]
 func (pc *ProductController) GetProducts(c fiber.Ctx) error {
@@ -55,9 +82,33 @@ func (pc *ProductController) GetProducts(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalids query params")
 	}
 
-	filters := q.ToCriterions()
-	products, err := pc.service.FindAll(filters)
+	if errs := pc.validator.Validate(q); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	filters, err := q.ToCriterions()
 	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	queryFilters, err := shared.ParseFilters(c.Queries(), ProductSchema)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	if q.AsOf != "" {
+		if len(queryFilters) > 0 || !q.onlyPagination() {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "as_of only supports page and limit")
+		}
+		return pc.getProductsAsOf(c, q, filters)
+	}
+	filters = append(queryFilters, filters...)
+
+	products, total, err := pc.service.FindAll(c.Context(), filters)
+	if err != nil {
+		if shared.IsCriteriaError(err) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch products")
 	}
 
@@ -65,22 +116,107 @@ func (pc *ProductController) GetProducts(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusNotFound, "Products not found")
 	}
 
-	if q.Limit > 0 || q.Page > 0 {
-		return shared.NewPaginatedResponse(c, fiber.StatusFound, products, q.Page, q.Limit)
+	info := q.pageInfo(products, total, filters)
+	if q.Facets {
+		facets, err := pc.service.Facets(c.Context(), filters)
+		if err != nil {
+			return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch product facets")
+		}
+		info.Facets = facets
+	}
+
+	return shared.NewPaginatedResponse(c, fiber.StatusFound, products, info)
+}
+
+// getProductsAsOf lists the catalog as it was at the as_of time of the query
+func (pc *ProductController) getProductsAsOf(c fiber.Ctx, q ProductQueryDTO, pagination []shared.Criterion) error {
+	asOf, err := time.Parse(time.RFC3339, q.AsOf)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, invalidAsOf)
+	}
+
+	products, total, err := pc.service.FindAllAsOf(c.Context(), asOf, pagination)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to rebuild products")
+	}
+
+	if len(products) == 0 {
+		return shared.NewErrorResponse(c, fiber.StatusNotFound, "Products not found")
+	}
+
+	return shared.NewPaginatedResponse(c, fiber.StatusFound, products, q.pageInfo(products, total, pagination))
+}
+
+const invalidAsOf = "Invalid as_of date, use RFC 3339 (e.g. 2026-05-01T10:00:00Z)"
+
+// @Summary Search products
+// @Description Full text search over product names and descriptions with prefix matching, ranked by relevance (name over description)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param q query string true "Search terms"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Param filter query string false "Generic filters as filter[field][op]=value, see GET /products"
+// @Success 200 {object} shared.PaginatedResponse{data=[]ProductSearchResult} "OK with ranked products and highlighted snippets"
+// @Failure 400 {object} shared.Response "Invalid query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /products/search [get]
+func (pc *ProductController) SearchProducts(c fiber.Ctx) error {
+	var q ProductSearchDTO
+	if err := c.Bind().Query(&q); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalids query params")
+	}
+
+	if errs := pc.validator.Validate(q); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	filters, err := q.ToCriterions()
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	return shared.NewSuccessResponse(c, fiber.StatusFound, products)
+	queryFilters, err := shared.ParseFilters(c.Queries(), ProductSchema)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+	filters = append(queryFilters, filters...)
+
+	results, total, err := pc.service.Search(c.Context(), q.Q, filters)
+	if err != nil {
+		if shared.IsCriteriaError(err) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to search products")
+	}
+
+	return shared.NewPaginatedResponse(c, fiber.StatusOK, results, shared.PageInfo{
+		Page:       q.Page,
+		Limit:      q.Limit,
+		TotalItems: total,
+	})
 }
 
 // @Summary Get product by ID
-// @Description Get a single product by its ID
+// @Description Get a single product by its ID. With as_of the product is rebuilt as it was at that time by replaying its history
 // @Tags products
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Product ID"
+// @Param as_of query string false "Rebuild the product as it was at this RFC 3339 time (e.g. 2026-05-01T10:00:00Z)"
 // @Success 200 {object} shared.Response{data=Product} "OK with product data"
-// @Failure 400 {object} shared.Response "Invalid product ID"
-// @Failure 404 {object} shared.Response "Product not found"
+// @Failure 400 {object} shared.Response "Invalid product ID or as_of date"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Product not found, or it didn't exist at as_of"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /products/{id} [get]
 func (pc *ProductController) GetProductByID(c fiber.Ctx) error {
@@ -90,7 +226,16 @@ func (pc *ProductController) GetProductByID(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid product ID")
 	}
 
-	product, err := pc.service.FindByID(uint(id))
+	var product *Product
+	if value := c.Query("as_of"); value != "" {
+		asOf, parseErr := time.Parse(time.RFC3339, value)
+		if parseErr != nil {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, invalidAsOf)
+		}
+		product, err = pc.service.FindByIDAsOf(c.Context(), uint(id), asOf)
+	} else {
+		product, err = pc.service.FindByID(c.Context(), uint(id))
+	}
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found")
@@ -107,9 +252,13 @@ func (pc *ProductController) GetProductByID(c fiber.Ctx) error {
 // @Tags products
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param product body CreateProductDTO true "Product data"
 // @Success 201 {object} shared.Response{data=Product} "Product created successfully"
 // @Failure 400 {object} shared.Response "Invalid request body"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 422 {object} shared.Response "Validation failed"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /products [post]
@@ -124,13 +273,19 @@ func (pc *ProductController) CreateProduct(c fiber.Ctx) error {
 	}
 
 	product := dto.ToProduct()
-	if _, err := pc.service.Create(product); err != nil {
-		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to create product")
-	}
-	if len(dto.CategoriesID) > 0 {
-		if err := pc.service.UpdateCategories(product, dto.CategoriesID); err != nil {
-			return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to set categories for product")
+	message := "Failed to create product"
+	err := pc.service.InTransaction(c.Context(), func(ctx context.Context) error {
+		if _, err := pc.service.Create(ctx, product); err != nil {
+			return err
+		}
+		if len(dto.CategoriesID) > 0 {
+			message = "Failed to set categories for product"
+			return pc.service.UpdateCategories(ctx, product, dto.CategoriesID)
 		}
+		return nil
+	})
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, message)
 	}
 	return shared.NewSuccessResponse(c, fiber.StatusCreated, product)
 }
@@ -140,10 +295,14 @@ func (pc *ProductController) CreateProduct(c fiber.Ctx) error {
 // @Tags products
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Product ID"
 // @Param product body UpdateProductDTO true "Product data"
 // @Success 200 {object} shared.Response{data=Product} "Product updated successfully"
 // @Failure 400 {object} shared.Response "Invalid request body or product ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Product not found"
 // @Failure 422 {object} shared.Response "Validation failed"
 // @Failure 500 {object} shared.Response "Internal server error"
@@ -164,7 +323,7 @@ func (pc *ProductController) UpdateProduct(c fiber.Ctx) error {
 		return shared.NewValidationErrorResponse(c, errs)
 	}
 
-	product, err := pc.service.FindByID(uint(id))
+	product, err := pc.service.FindByID(c.Context(), uint(id))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found")
@@ -177,11 +336,16 @@ func (pc *ProductController) UpdateProduct(c fiber.Ctx) error {
 	product.Price = dto.Price
 	product.Stock = dto.Stock
 
-	if _, err := pc.service.Update(product); err != nil {
-		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to update product")
-	}
-	if err := pc.service.UpdateCategories(product, dto.CategoriesID); err != nil {
-		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to update categories for product")
+	message := "Failed to update product"
+	err = pc.service.InTransaction(c.Context(), func(ctx context.Context) error {
+		if _, err := pc.service.Update(ctx, product); err != nil {
+			return err
+		}
+		message = "Failed to update categories for product"
+		return pc.service.UpdateCategories(ctx, product, dto.CategoriesID)
+	})
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, message)
 	}
 	return shared.NewSuccessResponse(c, fiber.StatusOK, product)
 }
@@ -192,10 +356,14 @@ func (pc *ProductController) UpdateProduct(c fiber.Ctx) error {
 // @Tags products
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Product ID"
 // @Param product body PatchProductDTO true "Product data"
 // @Success 200 {object} shared.Response{data=Product} "Product updated successfully"
 // @Failure 400 {object} shared.Response "Invalid request body or product ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Product not found"
 // @Failure 422 {object} shared.Response "Validation failed"
 // @Failure 500 {object} shared.Response "Internal server error"
@@ -216,7 +384,7 @@ func (pc *ProductController) PatchProduct(c fiber.Ctx) error {
 		return shared.NewValidationErrorResponse(c, errs)
 	}
 
-	product, err := pc.service.FindByID(uint(id))
+	product, err := pc.service.FindByID(c.Context(), uint(id))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found")
@@ -237,27 +405,36 @@ func (pc *ProductController) PatchProduct(c fiber.Ctx) error {
 		product.Stock = *dto.Stock
 	}
 
-	if _, err := pc.service.Update(product); err != nil {
-		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to update product")
-	}
-
-	if dto.CategoriesID != nil {
-		if err := pc.service.UpdateCategories(product, *dto.CategoriesID); err != nil {
-			return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to update categories for product")
+	message := "Failed to update product"
+	err = pc.service.InTransaction(c.Context(), func(ctx context.Context) error {
+		if _, err := pc.service.Update(ctx, product); err != nil {
+			return err
+		}
+		if dto.CategoriesID != nil {
+			message = "Failed to update categories for product"
+			return pc.service.UpdateCategories(ctx, product, *dto.CategoriesID)
 		}
+		return nil
+	})
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, message)
 	}
 
 	return shared.NewSuccessResponse(c, fiber.StatusOK, product)
 }
 
 // @Summary Delete a product
-// @Description Delete an existing product by its ID
+// @Description Soft delete an existing product by its ID, it can be restored from the trash
 // @Tags products
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Product ID"
 // @Success 200 {object} shared.Response "Product deleted successfully"
 // @Failure 400 {object} shared.Response "Invalid product ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Product not found"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /products/{id} [delete]
@@ -268,30 +445,174 @@ func (pc *ProductController) DeleteProduct(c fiber.Ctx) error {
 		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid product ID")
 	}
 
-	if _, err := pc.service.FindByID(uint(id)); err != nil {
+	if _, err := pc.service.FindByID(c.Context(), uint(id)); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found")
 		}
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch product")
 	}
 
-	if err := pc.service.Delete(uint(id)); err != nil {
+	if err := pc.service.Delete(c.Context(), uint(id)); err != nil {
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete product")
 	}
 
 	return shared.NewSuccessResponse(c, fiber.StatusOK, "Product deleted successfully")
 }
 
+// @Summary Get trashed products
+// @Description Get a paginated list of soft deleted products with optional filters
+// @Tags products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Param cursor query string false "Opaque cursor from next_cursor to read the following rows (keyset pagination)"
+// @Param sort query string false "Comma separated fields to sort by, prefix with - for descending (e.g. -price,name)"
+// @Param filter query string false "Generic filters as filter[field][op]=value, filter[not][field][op]=value or filter[or][group][field][op]=value (ops: eq, ne, gt, gte, lt, lte, in, like, ilike, null, between)"
+// @Param name query string false "Filter by product name (partial match)"
+// @Param description query string false "Filter by product description (partial match)"
+// @Param price_from query number false "Filter by minimum price"
+// @Param price_to query number false "Filter by maximum price"
+// @Param stock query int false "Filter by minimum stock"
+// @Param categories_id query []int false "Filter by category IDs" collectionFormat(multi)
+// @Param categories_match query string false "Match any, all or none of categories_id" Enums(any, all, none) default(any)
+// @Success 200 {object} shared.PaginatedResponse{data=[]Product} "OK with paginated trashed products"
+// @Failure 400 {object} shared.Response "Invalid query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /products/trash [get]
+func (pc *ProductController) GetTrashedProducts(c fiber.Ctx) error {
+	var q ProductQueryDTO
+	if err := c.Bind().Query(&q); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalids query params")
+	}
+
+	if errs := pc.validator.Validate(q); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	filters, err := q.ToCriterions()
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	queryFilters, err := shared.ParseFilters(c.Queries(), ProductSchema)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+	filters = append(queryFilters, filters...)
+
+	products, total, err := pc.service.FindTrashed(c.Context(), filters)
+	if err != nil {
+		if shared.IsCriteriaError(err) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch trashed products")
+	}
+
+	return shared.NewPaginatedResponse(c, fiber.StatusOK, products, q.pageInfo(products, total, filters))
+}
+
+// @Summary Restore a product
+// @Description Restore a soft deleted product from the trash
+// @Tags products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Product ID"
+// @Success 200 {object} shared.Response{data=Product} "Product restored successfully"
+// @Failure 400 {object} shared.Response "Invalid product ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Product not found in trash"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /products/{id}/restore [post]
+func (pc *ProductController) RestoreProduct(c fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid product ID")
+	}
+
+	if _, err := pc.service.FindTrashedByID(c.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found in trash")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch product")
+	}
+
+	if err := pc.service.Restore(c.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found in trash")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to restore product")
+	}
+
+	product, err := pc.service.FindByID(c.Context(), uint(id))
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch product")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, product)
+}
+
+// @Summary Purge a product
+// @Description Permanently delete a trashed product together with its history
+// @Tags products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Product ID"
+// @Success 200 {object} shared.Response "Product purged successfully"
+// @Failure 400 {object} shared.Response "Invalid product ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Product not found in trash"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /products/{id}/purge [delete]
+func (pc *ProductController) PurgeProduct(c fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid product ID")
+	}
+
+	if _, err := pc.service.FindTrashedByID(c.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found in trash")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch product")
+	}
+
+	if err := pc.service.Purge(c.Context(), uint(id)); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to purge product")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, "Product purged successfully")
+}
+
 // @Summary Get product history
 // @Description Get the history of changes for a product
 // @Tags products
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "Product ID"
 // @Param start query string false "Start date for history (YYYY-MM-DD)"
 // @Param end query string false "End date for history (YYYY-MM-DD)"
+// @Param actor_id query int false "Only the changes made by this user or API key ID"
+// @Param actor_type query string false "Only the changes made by this kind of actor" Enums(user, api_key, system)
 // @Success 200 {object} shared.Response{data=[]ProductHistory} "OK with product history"
 // @Failure 400 {object} shared.Response "Invalid product ID or query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
 // @Failure 404 {object} shared.Response "Product not found or no history found"
 // @Failure 500 {object} shared.Response "Internal server error"
 // @Router /products/{id}/history [get]
@@ -305,14 +626,14 @@ func (pc *ProductController) GetProductHistory(c fiber.Ctx) error {
 	startStr := c.Query("start")
 	endStr := c.Query("end")
 	layout := "2006-01-02"
-	var start, end *time.Time
+	var filter ProductHistoryFilter
 
 	if startStr != "" {
 		parsedTime, err := time.Parse(layout, startStr)
 		if err != nil {
 			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid start date format, use YYYY-MM-DD")
 		}
-		start = &parsedTime
+		filter.Start = &parsedTime
 	}
 
 	if endStr != "" {
@@ -320,24 +641,123 @@ func (pc *ProductController) GetProductHistory(c fiber.Ctx) error {
 		if err != nil {
 			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid end date format, use YYYY-MM-DD")
 		}
-		end = &parsedTime
+		filter.End = &parsedTime
 	}
 
-	if _, err := pc.service.FindByID(uint(id)); err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found")
+	if actorIDStr := c.Query("actor_id"); actorIDStr != "" {
+		actorID, err := strconv.ParseUint(actorIDStr, 10, 32)
+		if err != nil {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid actor ID")
 		}
-		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch product")
+		actor := uint(actorID)
+		filter.ActorID = &actor
+	}
+
+	switch actorType := c.Query("actor_type"); actorType {
+	case "", shared.PrincipalUser, shared.PrincipalAPIKey, shared.ActorSystem:
+		filter.ActorType = actorType
+	default:
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid actor type, use user, api_key or system")
 	}
 
-	histories, err := pc.service.FindHistoryByProductID(uint(id), start, end)
+	// the history outlives the product, it is still listed once the product is trashed or purged
+	histories, err := pc.service.FindHistoryByProductID(c.Context(), uint(id), filter)
 	if err != nil {
 		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch product history")
 	}
 
 	if len(histories) == 0 {
+		if _, err := pc.service.FindByID(c.Context(), uint(id)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product not found")
+			}
+			return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch product")
+		}
 		return shared.NewSuccessResponse(c, fiber.StatusOK, []ProductHistory{})
 	}
 
 	return shared.NewSuccessResponse(c, fiber.StatusOK, histories)
 }
+
+// @Summary Get a product history entry as JSON Patch
+// @Description Get the changes of a history entry as JSON Patch (RFC 6902) operations over the product.
+// @Description Updated fields are preceded by a test of their previous value, categories are addressed by ID as /Categories/{id}
+// @Tags products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Product ID"
+// @Param historyUUID path string true "History entry UUID"
+// @Success 200 {object} shared.Response{data=[]shared.PatchOperation} "OK with JSON Patch operations"
+// @Failure 400 {object} shared.Response "Invalid product ID or history UUID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "History entry not found"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /products/{id}/history/{historyUUID}/patch [get]
+func (pc *ProductController) GetProductHistoryPatch(c fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid product ID")
+	}
+	historyUUID, err := uuid.Parse(c.Params("historyUUID"))
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid history UUID")
+	}
+
+	operations, err := pc.service.HistoryPatch(c.Context(), uint(id), historyUUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "History entry not found")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to build history patch")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, operations)
+}
+
+// @Summary Revert a product to a history revision
+// @Description Rebuild the product as it was right after the history entry and save it, which records a new history entry.
+// @Description With dry_run the product is not changed and the response shows the changes the revert would make
+// @Tags products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Product ID"
+// @Param historyUUID path string true "History entry UUID"
+// @Param dry_run query bool false "Only show the changes"
+// @Success 200 {object} shared.Response{data=ProductRevert} "Product reverted, or the changes of the dry run"
+// @Failure 400 {object} shared.Response "Invalid product ID, history UUID or dry_run"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Product or history entry not found"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /products/{id}/history/{historyUUID}/revert [post]
+func (pc *ProductController) RevertProduct(c fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid product ID")
+	}
+	historyUUID, err := uuid.Parse(c.Params("historyUUID"))
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid history UUID")
+	}
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid dry_run, use true or false")
+		}
+	}
+
+	revert, err := pc.service.Revert(c.Context(), uint(id), historyUUID, dryRun)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Product or history entry not found")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to revert product")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, revert)
+}
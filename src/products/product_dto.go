@@ -8,12 +8,30 @@ import (
 type ProductQueryDTO struct {
 	Page         int              `query:"page" validate:"gte=0"`
 	Limit        int              `query:"limit" validate:"gte=0,lte=100"`
+	Cursor       string           `query:"cursor"`
+	Sort         string           `query:"sort"`
 	Name         string           `query:"name"`
 	Description  string           `query:"description"`
 	PriceFrom    *decimal.Decimal `query:"price_from"`
 	PriceTo      *decimal.Decimal `query:"price_to"`
 	Stock        int              `query:"stock"`
 	CategoriesID []uint           `query:"categories_id"`
+	// CategoriesMatch sets if products must belong to any, all or none of CategoriesID
+	CategoriesMatch string `query:"categories_match" validate:"omitempty,oneof=any all none"`
+	// Facets adds the category, price and stock counts of the whole listing to the response
+	Facets bool `query:"facets"`
+	// AsOf lists the catalog as it was at that RFC 3339 time, only along with page and limit
+	AsOf string `query:"as_of"`
+}
+
+type ProductSearchDTO struct {
+	Q     string `query:"q" validate:"required"`
+	Page  int    `query:"page" validate:"gte=0"`
+	Limit int    `query:"limit" validate:"gte=0,lte=100"`
+}
+
+func (dto *ProductSearchDTO) ToCriterions() ([]shared.Criterion, error) {
+	return shared.PaginationCriteria(dto.Page, dto.Limit, "", nil)
 }
 
 type CreateProductDTO struct {
@@ -50,7 +68,7 @@ type PatchProductDTO struct {
 }
 
 // TODO abstract commons criteria & inherit it
-func (dto *ProductQueryDTO) ToCriterions() []shared.Criterion {
+func (dto *ProductQueryDTO) ToCriterions() ([]shared.Criterion, error) {
 	criterions := make([]shared.Criterion, 0)
 
 	if dto.Name != "" {
@@ -93,24 +111,52 @@ func (dto *ProductQueryDTO) ToCriterions() []shared.Criterion {
 		})
 	}
 
-	limit := dto.Limit
-	if limit <= 0 {
-		limit = 10
+	if len(dto.CategoriesID) > 0 {
+		operator := shared.OpIn
+		switch dto.CategoriesMatch {
+		case "all":
+			operator = shared.OpAll
+		case "none":
+			operator = shared.OpNone
+		}
+		criterions = append(criterions, shared.Criterion{
+			Field:    "categories",
+			Operator: operator,
+			Value:    dto.CategoriesID,
+		})
 	}
-	criterions = append(criterions, shared.Criterion{
-		Operator: shared.OpLimit,
-		Value:    limit,
-	})
-
-	page := dto.Page
-	if page <= 0 {
-		page = 1
+
+	sorts, err := shared.ParseSort(dto.Sort, ProductSchema)
+	if err != nil {
+		return nil, err
 	}
-	offset := (page - 1) * limit
-	criterions = append(criterions, shared.Criterion{
-		Operator: shared.OpOffset,
-		Value:    offset,
-	})
+	criterions = append(criterions, sorts...)
 
-	return criterions
+	pagination, err := shared.PaginationCriteria(dto.Page, dto.Limit, dto.Cursor, sorts)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(criterions, pagination...), nil
+}
+
+// onlyPagination reports if no filter, sort, cursor or facets are requested besides page and limit
+func (dto *ProductQueryDTO) onlyPagination() bool {
+	return dto.Cursor == "" && dto.Sort == "" && dto.Name == "" && dto.Description == "" &&
+		dto.PriceFrom == nil && dto.PriceTo == nil && dto.Stock == 0 && len(dto.CategoriesID) == 0 &&
+		dto.CategoriesMatch == "" && !dto.Facets
+}
+
+func (dto *ProductQueryDTO) pageInfo(products []Product, total int64, criteria []shared.Criterion) shared.PageInfo {
+	_, limit := shared.NormalizePagination(dto.Page, dto.Limit)
+	info := shared.PageInfo{
+		Page:       dto.Page,
+		Limit:      dto.Limit,
+		TotalItems: total,
+		Cursor:     dto.Cursor,
+	}
+	if len(products) > 0 {
+		info.NextCursor = shared.NextCursor(products[len(products)-1], criteria, len(products), limit)
+	}
+	return info
 }
@@ -1,34 +1,158 @@
 package products
 
-import "github.com/Javieradel/api-qisur.git/src/shared"
+import (
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+func init() {
+	shared.RegisterEvents(ProductCreatedEvent{}, ProductUpdatedEvent{}, ProductCategoriesUpdatedEvent{}, ProductDeletedEvent{},
+		ProductRestoredEvent{}, ProductPurgedEvent{})
+}
 
 // ProductCreatedEvent is published when a product is created
 type ProductCreatedEvent struct {
 	shared.Event
+	shared.EventMeta
 	Product Product
+	Actor   shared.Actor
 }
 
 func (e ProductCreatedEvent) Topic() string {
 	return "product.created"
 }
 
+func (e ProductCreatedEvent) Tenant() uint {
+	return e.Product.TenantID
+}
+
+func (e ProductCreatedEvent) Payload() any {
+	return e.Product
+}
+
 // ProductUpdatedEvent is published when a product is updated
 type ProductUpdatedEvent struct {
 	shared.Event
+	shared.EventMeta
 	OldProduct Product
 	NewProduct Product
+	Actor      shared.Actor
 }
 
 func (e ProductUpdatedEvent) Topic() string {
 	return "product.updated"
 }
 
+func (e ProductUpdatedEvent) Tenant() uint {
+	return e.NewProduct.TenantID
+}
+
+func (e ProductUpdatedEvent) Payload() any {
+	return ProductChange{Before: e.OldProduct, After: e.NewProduct}
+}
+
+// ProductChange is the payload of ProductUpdatedEvent
+type ProductChange struct {
+	Before Product
+	After  Product
+}
+
+// ProductCategoriesUpdatedEvent is published when categories are added to or removed from a product
+type ProductCategoriesUpdatedEvent struct {
+	shared.Event
+	shared.EventMeta
+	Product Product
+	Added   []CategoryRef
+	Removed []CategoryRef
+	Actor   shared.Actor
+}
+
+func (e ProductCategoriesUpdatedEvent) Topic() string {
+	return "product.categories_updated"
+}
+
+func (e ProductCategoriesUpdatedEvent) Tenant() uint {
+	return e.Product.TenantID
+}
+
+func (e ProductCategoriesUpdatedEvent) Payload() any {
+	return ProductCategoriesChange{ProductID: e.Product.ID, Added: e.Added, Removed: e.Removed}
+}
+
+// CategoryRef identifies a category added to or removed from a product
+type CategoryRef struct {
+	ID   uint
+	Name string
+}
+
+// ProductCategoriesChange is the payload of ProductCategoriesUpdatedEvent
+type ProductCategoriesChange struct {
+	ProductID uint
+	Added     []CategoryRef
+	Removed   []CategoryRef
+}
+
 // ProductDeletedEvent is published when a product is deleted
 type ProductDeletedEvent struct {
 	shared.Event
+	shared.EventMeta
 	ProductID uint
+	TenantID  uint
+	Actor     shared.Actor
 }
 
 func (e ProductDeletedEvent) Topic() string {
 	return "product.deleted"
 }
+
+func (e ProductDeletedEvent) Tenant() uint {
+	return e.TenantID
+}
+
+func (e ProductDeletedEvent) Payload() any {
+	return map[string]uint{"ID": e.ProductID}
+}
+
+// ProductRestoredEvent is published when a product is taken out of the trash
+type ProductRestoredEvent struct {
+	shared.Event
+	shared.EventMeta
+	Product Product
+	// DeletedAt is when the product had been moved to the trash
+	DeletedAt time.Time
+	Actor     shared.Actor
+}
+
+func (e ProductRestoredEvent) Topic() string {
+	return "product.restored"
+}
+
+func (e ProductRestoredEvent) Tenant() uint {
+	return e.Product.TenantID
+}
+
+func (e ProductRestoredEvent) Payload() any {
+	return e.Product
+}
+
+// ProductPurgedEvent is published when a product is permanently removed, only its history is kept
+type ProductPurgedEvent struct {
+	shared.Event
+	shared.EventMeta
+	ProductID uint
+	TenantID  uint
+	Actor     shared.Actor
+}
+
+func (e ProductPurgedEvent) Topic() string {
+	return "product.purged"
+}
+
+func (e ProductPurgedEvent) Tenant() uint {
+	return e.TenantID
+}
+
+func (e ProductPurgedEvent) Payload() any {
+	return map[string]uint{"ID": e.ProductID}
+}
@@ -0,0 +1,79 @@
+package products
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// priceFacetBounds are the limits between the price buckets, the first bucket is below
+// the first bound and the last one above the last bound
+var priceFacetBounds = []int{10, 25, 50, 100, 250, 500, 1000}
+
+// ProductFacets are the aggregated counts of the products matching a listing filter
+type ProductFacets struct {
+	Categories []CategoryFacet `json:"categories"`
+	Price      []PriceFacet    `json:"price"`
+	Stock      []StockFacet    `json:"stock"`
+}
+
+type CategoryFacet struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// PriceFacet counts the products with From <= price < To, a nil bound is unlimited
+type PriceFacet struct {
+	From  *decimal.Decimal `json:"from"`
+	To    *decimal.Decimal `json:"to"`
+	Count int64            `json:"count"`
+}
+
+type StockFacet struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type priceBucketRow struct {
+	Bucket int
+	Count  int64
+}
+
+type stockRow struct {
+	InStock bool
+	Count   int64
+}
+
+// priceFacets turns the width_bucket counts into price ranges, including the empty ones
+func priceFacets(rows []priceBucketRow) []PriceFacet {
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Bucket] = row.Count
+	}
+
+	facets := make([]PriceFacet, 0, len(priceFacetBounds)+1)
+	for bucket := 0; bucket <= len(priceFacetBounds); bucket++ {
+		facet := PriceFacet{Count: counts[bucket]}
+		if bucket > 0 {
+			from := decimal.NewFromInt(int64(priceFacetBounds[bucket-1]))
+			facet.From = &from
+		}
+		if bucket < len(priceFacetBounds) {
+			to := decimal.NewFromInt(int64(priceFacetBounds[bucket]))
+			facet.To = &to
+		}
+		facets = append(facets, facet)
+	}
+	return facets
+}
+
+func stockFacets(rows []stockRow) []StockFacet {
+	facets := []StockFacet{{Key: "in_stock"}, {Key: "out_of_stock"}}
+	for _, row := range rows {
+		if row.InStock {
+			facets[0].Count = row.Count
+		} else {
+			facets[1].Count = row.Count
+		}
+	}
+	return facets
+}
@@ -1,8 +1,10 @@
 package products
 
 import (
+	"strconv"
 	"time"
 
+	"github.com/Javieradel/api-qisur.git/src/shared"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -12,28 +14,123 @@ type ProductHistory struct {
 	ID        uint      `gorm:"primaryKey"`
 	UUID      uuid.UUID `gorm:"type:uuid;"`
 	ProductID uint      `gorm:"index"`
+	TenantID  uint      `gorm:"index;not null"`
 	ChangedAt time.Time
-	Details   []ProductHistoryDetail `gorm:"foreignKey:ProductHistoryID"`
+	ActorID   *uint  `gorm:"index"`
+	ActorType string `gorm:"type:varchar(32);index"`
+	IP        string `gorm:"type:varchar(64)"`
+	UserAgent string `gorm:"type:text"`
+	// EventID is the idempotency key of the event recorded, an event is recorded once
+	EventID *uuid.UUID             `gorm:"type:uuid;uniqueIndex"`
+	Details []ProductHistoryDetail `gorm:"foreignKey:ProductHistoryID"`
+}
+
+// ProductHistoryFilter narrows the history entries of a product
+type ProductHistoryFilter struct {
+	Start     *time.Time
+	End       *time.Time
+	ActorID   *uint
+	ActorType string
 }
 
 func (p *ProductHistory) BeforeCreate(tx *gorm.DB) (err error) {
 	if p.UUID == uuid.Nil {
 		p.UUID = uuid.New()
 	}
-	return
+	return shared.AssignTenant(tx, &p.TenantID)
+}
+
+func newProductHistory(product Product, actor shared.Actor, meta shared.EventMeta) ProductHistory {
+	eventID := meta.ID
+	return ProductHistory{
+		UUID:      uuid.New(),
+		ProductID: product.ID,
+		TenantID:  product.TenantID,
+		ChangedAt: meta.OccurredAt,
+		EventID:   &eventID,
+		ActorID:   actor.ID,
+		ActorType: actor.Type,
+		IP:        actor.IP,
+		UserAgent: actor.UserAgent,
+	}
+}
+
+func (h ProductHistory) HistoryID() uint {
+	return h.ID
 }
 
 func (ProductHistory) TableName() string {
 	return "product_histories"
 }
 
-// ProductHistoryDetail represents the details of a specific field change within a product history entry
+// isCreation reports if the entry records the creation of the product, every field set without a previous value
+func (h ProductHistory) isCreation() bool {
+	if len(h.Details) == 0 {
+		return false
+	}
+	for _, detail := range h.Details {
+		if detail.Change != "" || detail.OldValue != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// JSONPatch describes the entry as a JSON Patch (RFC 6902) over the product. Updated fields are
+// preceded by a test of their previous value and the categories are addressed by ID, as /Categories/{id}
+func (h ProductHistory) JSONPatch() ([]shared.PatchOperation, error) {
+	operations := make([]shared.PatchOperation, 0, len(h.Details))
+	add := func(op string, value *shared.HistoryValue, tokens ...string) error {
+		operation, err := shared.NewPatchOperation(op, value, tokens...)
+		if err != nil {
+			return err
+		}
+		operations = append(operations, operation)
+		return nil
+	}
+
+	for _, detail := range h.Details {
+		var err error
+		switch {
+		case detail.Change == HistoryChangeAdded && detail.ReferenceID != nil:
+			err = add("add", detail.NewValue, detail.Field, strconv.FormatUint(uint64(*detail.ReferenceID), 10))
+		case detail.Change == HistoryChangeRemoved && detail.ReferenceID != nil:
+			err = add("remove", nil, detail.Field, strconv.FormatUint(uint64(*detail.ReferenceID), 10))
+		case detail.OldValue == nil:
+			err = add("add", detail.NewValue, detail.Field)
+		default:
+			if err = add("test", detail.OldValue, detail.Field); err == nil {
+				err = add("replace", detail.NewValue, detail.Field)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return operations, nil
+}
+
+const (
+	HistoryChangeAdded   = "added"
+	HistoryChangeRemoved = "removed"
+)
+
+// ProductHistoryDetail represents the details of a specific field change within a product history entry.
+// Changes of associations, like the categories, have one detail per associated row: Change tells if it was
+// added or removed, ReferenceID is the ID of the row and the values hold the row itself.
+// The values are typed, see shared.HistoryValue
 type ProductHistoryDetail struct {
-	ID               uint    `gorm:"primaryKey"`
-	ProductHistoryID uint    `gorm:"index"`
-	Field            string  `gorm:"type:varchar(255)"`
-	OldValue         *string `gorm:"type:text"`
-	NewValue         string  `gorm:"type:text"`
+	ID               uint                 `gorm:"primaryKey"`
+	ProductHistoryID uint                 `gorm:"index"`
+	Field            string               `gorm:"type:varchar(255)"`
+	OldValue         *shared.HistoryValue `gorm:"type:jsonb"`
+	NewValue         *shared.HistoryValue `gorm:"type:jsonb"`
+	Change           string               `gorm:"type:varchar(16)"`
+	ReferenceID      *uint
+}
+
+func (d *ProductHistoryDetail) SetHistoryID(id uint) {
+	d.ProductHistoryID = id
 }
 
 // TableName overrides the table name used by ProductHistoryDetail to `product_history_details`
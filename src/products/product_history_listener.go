@@ -1,12 +1,9 @@
 package products
 
 import (
-	"fmt"
-	"reflect"
-	"time"
+	"context"
 
 	"github.com/Javieradel/api-qisur.git/src/shared"
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -18,81 +15,79 @@ func NewProductHistoryListener(db *gorm.DB) *ProductHistoryListener {
 	return &ProductHistoryListener{DB: db}
 }
 
-func (l *ProductHistoryListener) Handle(event shared.Event) {
+// HandleTx records the history in the transaction of the change, so a change is never stored unaudited
+func (l *ProductHistoryListener) HandleTx(ctx context.Context, event shared.Event) error {
 	switch e := event.(type) {
 	case ProductCreatedEvent:
-		l.handleProductCreated(e)
+		return l.handleProductCreated(ctx, e)
 	case ProductUpdatedEvent:
-		l.handleProductUpdated(e)
+		return l.handleProductUpdated(ctx, e)
+	case ProductCategoriesUpdatedEvent:
+		return l.handleProductCategoriesUpdated(ctx, e)
 	case ProductDeletedEvent:
+		return l.handleProductDeleted(ctx, e)
+	case ProductRestoredEvent:
+		return l.handleProductRestored(ctx, e)
+	case ProductPurgedEvent:
+		return l.handleProductPurged(ctx, e)
 	}
+	return nil
 }
 
-func (l *ProductHistoryListener) handleProductCreated(event ProductCreatedEvent) {
-	history := ProductHistory{
-		UUID:      uuid.New(),
-		ProductID: event.Product.ID,
-		ChangedAt: time.Now(),
-	}
-	if err := l.DB.Create(&history).Error; err != nil {
-		fmt.Println("Error creating product history:", err)
-		return
-	}
-
-	val := reflect.ValueOf(event.Product)
-	typeOfS := val.Type()
+func (l *ProductHistoryListener) handleProductCreated(ctx context.Context, event ProductCreatedEvent) error {
+	return l.record(ctx, newProductHistory(event.Product, event.Actor, event.EventMeta), shared.DiffFields(nil, event.Product))
+}
 
-	for i := 0; i < val.NumField(); i++ {
-		field := typeOfS.Field(i).Name
-		if field == "ID" || field == "CreatedAt" || field == "UpdatedAt" || field == "DeletedAt" {
-			continue
-		}
-		detail := ProductHistoryDetail{
-			ProductHistoryID: history.ID,
-			Field:            field,
-			NewValue:         fmt.Sprintf("%v", val.Field(i).Interface()),
-		}
-		if err := l.DB.Create(&detail).Error; err != nil {
-			fmt.Println("Error creating product history detail:", err)
-		}
-	}
+func (l *ProductHistoryListener) handleProductUpdated(ctx context.Context, event ProductUpdatedEvent) error {
+	return l.record(ctx, newProductHistory(event.NewProduct, event.Actor, event.EventMeta), shared.DiffFields(event.OldProduct, event.NewProduct))
 }
 
-func (l *ProductHistoryListener) handleProductUpdated(event ProductUpdatedEvent) {
-	history := ProductHistory{
-		UUID:      uuid.New(),
-		ProductID: event.NewProduct.ID,
-		ChangedAt: time.Now(),
-	}
-	if err := l.DB.Create(&history).Error; err != nil {
-		fmt.Println("Error creating product history:", err)
-		return
-	}
+func (l *ProductHistoryListener) handleProductDeleted(ctx context.Context, event ProductDeletedEvent) error {
+	product := Product{ID: event.ProductID, TenantID: event.TenantID}
+	return l.record(ctx, newProductHistory(product, event.Actor, event.EventMeta), []shared.FieldChange{shared.DeletionChange(event.OccurredAt)})
+}
 
-	oldVal := reflect.ValueOf(event.OldProduct)
-	newVal := reflect.ValueOf(event.NewProduct)
-	typeOfS := oldVal.Type()
+func (l *ProductHistoryListener) handleProductRestored(ctx context.Context, event ProductRestoredEvent) error {
+	return l.record(ctx, newProductHistory(event.Product, event.Actor, event.EventMeta), []shared.FieldChange{shared.RestorationChange(event.DeletedAt)})
+}
 
-	for i := 0; i < oldVal.NumField(); i++ {
-		field := typeOfS.Field(i).Name
-		if field == "ID" || field == "CreatedAt" || field == "UpdatedAt" || field == "DeletedAt" {
-			continue
-		}
+// handleProductPurged records the last entry of the history, which outlives the product
+func (l *ProductHistoryListener) handleProductPurged(ctx context.Context, event ProductPurgedEvent) error {
+	product := Product{ID: event.ProductID, TenantID: event.TenantID}
+	return l.record(ctx, newProductHistory(product, event.Actor, event.EventMeta), []shared.FieldChange{shared.PurgeChange(event.OccurredAt)})
+}
 
-		oldValue := fmt.Sprintf("%v", oldVal.Field(i).Interface())
-		newValue := fmt.Sprintf("%v", newVal.Field(i).Interface())
+// handleProductCategoriesUpdated records a detail per category added or removed
+func (l *ProductHistoryListener) handleProductCategoriesUpdated(ctx context.Context, event ProductCategoriesUpdatedEvent) error {
+	details := make([]ProductHistoryDetail, 0, len(event.Added)+len(event.Removed))
+	for _, category := range event.Added {
+		details = append(details, ProductHistoryDetail{
+			Field:       "Categories",
+			NewValue:    shared.NewHistoryValue(category),
+			Change:      HistoryChangeAdded,
+			ReferenceID: &category.ID,
+		})
+	}
+	for _, category := range event.Removed {
+		details = append(details, ProductHistoryDetail{
+			Field:       "Categories",
+			OldValue:    shared.NewHistoryValue(category),
+			Change:      HistoryChangeRemoved,
+			ReferenceID: &category.ID,
+		})
+	}
+	history := newProductHistory(event.Product, event.Actor, event.EventMeta)
+	return shared.RecordHistory(ctx, l.DB, &history, details)
+}
 
-		if oldValue != newValue {
-			oldValuePtr := &oldValue
-			detail := ProductHistoryDetail{
-				ProductHistoryID: history.ID,
-				Field:            field,
-				OldValue:         oldValuePtr,
-				NewValue:         newValue,
-			}
-			if err := l.DB.Create(&detail).Error; err != nil {
-				fmt.Println("Error creating product history detail:", err)
-			}
+func (l *ProductHistoryListener) record(ctx context.Context, history ProductHistory, changes []shared.FieldChange) error {
+	details := make([]ProductHistoryDetail, len(changes))
+	for i, change := range changes {
+		details[i] = ProductHistoryDetail{
+			Field:    change.Field,
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
 		}
 	}
-}
\ No newline at end of file
+	return shared.RecordHistory(ctx, l.DB, &history, details)
+}
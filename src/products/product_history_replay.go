@@ -0,0 +1,115 @@
+package products
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/categories"
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+// ProductRevert is the outcome of reverting a product to a history revision
+type ProductRevert struct {
+	// Product is the product as reverted, or as it would be on a dry run
+	Product           Product
+	Changes           []shared.FieldChange
+	AddedCategories   []CategoryRef
+	RemovedCategories []CategoryRef
+	DryRun            bool
+}
+
+// productSnapshot is the state of a product rebuilt by replaying its history
+type productSnapshot struct {
+	fields map[string]*shared.HistoryValue
+	// categories is nil when the history is recorded neither from the creation of the product nor
+	// with a category change, the categories are unknown then
+	categories map[uint]CategoryRef
+}
+
+// replayHistory applies the history entries from the oldest to the newest, whatever their order
+func replayHistory(histories []ProductHistory) productSnapshot {
+	ordered := slices.Clone(histories)
+	slices.SortStableFunc(ordered, func(a, b ProductHistory) int {
+		if c := a.ChangedAt.Compare(b.ChangedAt); c != 0 {
+			return c
+		}
+		return int(a.ID) - int(b.ID)
+	})
+
+	snapshot := productSnapshot{fields: make(map[string]*shared.HistoryValue)}
+	// a product is created without categories, they are all recorded as added afterwards
+	if len(ordered) > 0 && ordered[0].isCreation() {
+		snapshot.categories = make(map[uint]CategoryRef)
+	}
+	for _, history := range ordered {
+		for _, detail := range history.Details {
+			switch {
+			case detail.Change != "" && detail.ReferenceID != nil:
+				snapshot.applyReference(detail)
+			case detail.Change == "" && detail.NewValue != nil:
+				snapshot.fields[detail.Field] = detail.NewValue
+			}
+		}
+	}
+	return snapshot
+}
+
+func (s *productSnapshot) applyReference(detail ProductHistoryDetail) {
+	if detail.Field != "Categories" {
+		return
+	}
+	if s.categories == nil {
+		s.categories = make(map[uint]CategoryRef)
+	}
+
+	ref := CategoryRef{ID: *detail.ReferenceID}
+	if detail.Change == HistoryChangeRemoved {
+		delete(s.categories, ref.ID)
+		return
+	}
+	// the name is informative, details recorded before the values were typed only hold it as a string
+	var recorded CategoryRef
+	if err := detail.NewValue.AssignTo(&recorded); err == nil {
+		ref.Name = recorded.Name
+	}
+	s.categories[ref.ID] = ref
+}
+
+// applyTo sets the recorded fields and categories on the product, the fields never recorded keep their value
+// and so do the categories when they are unknown
+func (s productSnapshot) applyTo(product *Product) error {
+	for field, value := range s.fields {
+		if _, err := shared.AssignField(product, field, value); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+
+	if s.categories != nil {
+		product.Categories = make([]categories.Categories, 0, len(s.categories))
+		for _, ref := range s.categories {
+			product.Categories = append(product.Categories, categories.Categories{ID: ref.ID, Name: ref.Name})
+		}
+		slices.SortFunc(product.Categories, func(a, b categories.Categories) int { return int(a.ID) - int(b.ID) })
+	}
+	return nil
+}
+
+// rebuildProduct returns the product with its history replayed on it, the product itself is left untouched
+func rebuildProduct(product Product, histories []ProductHistory) (Product, productSnapshot, error) {
+	snapshot := replayHistory(histories)
+	rebuilt := product
+	rebuilt.Categories = slices.Clone(product.Categories)
+	if err := snapshot.applyTo(&rebuilt); err != nil {
+		return product, snapshot, err
+	}
+	return rebuilt, snapshot, nil
+}
+
+// existedAt reports if the product was created and not yet in the trash at the given time
+func existedAt(product Product, at time.Time) bool {
+	if product.CreatedAt.After(at) {
+		return false
+	}
+	return !product.DeletedAt.Valid || product.DeletedAt.Time.After(at)
+}
@@ -1,78 +1,449 @@
 package products
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Javieradel/api-qisur.git/src/categories"
 	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ProductRepository struct {
-	DB *gorm.DB
+	DB             *gorm.DB
+	searchLanguage string
 }
 
 func NewProductRepository(db *gorm.DB) *ProductRepository {
-	return &ProductRepository{DB: db}
+	return &ProductRepository{DB: db, searchLanguage: SearchLanguage()}
 }
 
-func (r *ProductRepository) Create(product *Product) error {
-	return r.DB.Create(product).Error
+// db returns the connection bound to the context, which carries the tenant the queries are scoped to
+// and the transaction of the unit of work in progress, if any
+func (r *ProductRepository) db(ctx context.Context) *gorm.DB {
+	return shared.DB(ctx, r.DB)
 }
 
-// ! Product updated are be inserted on last
-func (r *ProductRepository) FindAll(criteria []shared.Criterion) ([]Product, error) {
+func (r *ProductRepository) Create(ctx context.Context, product *Product) error {
+	return r.db(ctx).Omit(clause.Associations).Create(product).Error
+}
+
+// FindAll returns the products matching the criteria and the total of matches ignoring LIMIT/OFFSET
+func (r *ProductRepository) FindAll(ctx context.Context, criteria []shared.Criterion) ([]Product, int64, error) {
 	var products []Product
-	query := r.DB.Model(&Product{}).Preload("Categories")
+	var total int64
 
-	if len(criteria) > 0 {
-		query = shared.ApplyCriteria(query, criteria)
+	countQuery, err := shared.ApplyCriteria(r.db(ctx).Model(&Product{}), ProductSchema, shared.WithoutPagination(criteria))
+	if err != nil {
+		return nil, 0, err
 	}
 
-	err := query.Find(&products).Error
+	if err := countQuery.Count(&total).Error; err != nil {
+		log.Printf("Error counting products %+v: %v", criteria, err)
+		return nil, 0, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	query, err := shared.ApplyCriteria(r.db(ctx).Model(&Product{}).Preload("Categories"), ProductSchema, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Find(&products).Error
 
 	if err != nil {
 		log.Printf("Error fetching products %+v: %v", criteria, err)
-		return nil, fmt.Errorf("failed to fetch products: %w", err)
+		return nil, 0, fmt.Errorf("failed to fetch products: %w", err)
+	}
+
+	return products, total, nil
+}
+
+// Facets counts the products matching the criteria by category, price bucket and stock availability,
+// pagination and sorting criteria are ignored
+func (r *ProductRepository) Facets(ctx context.Context, criteria []shared.Criterion) (*ProductFacets, error) {
+	filters := shared.WithoutPagination(criteria)
+	facets := &ProductFacets{}
+
+	categoriesQuery, err := shared.ApplyCriteria(r.db(ctx).Model(&Product{}), ProductSchema, filters)
+	if err != nil {
+		return nil, err
+	}
+	err = categoriesQuery.
+		Joins("JOIN product_categories ON product_categories.product_id = products.id AND product_categories.deleted_at IS NULL").
+		Joins("JOIN categories ON categories.id = product_categories.category_id AND categories.deleted_at IS NULL").
+		Select("categories.id, categories.name, COUNT(DISTINCT products.id) AS count").
+		Group("categories.id, categories.name").
+		Order("count DESC, categories.id").
+		Scan(&facets.Categories).Error
+	if err != nil {
+		log.Printf("Error counting category facets %+v: %v", criteria, err)
+		return nil, fmt.Errorf("failed to count category facets: %w", err)
+	}
+
+	bounds := make([]string, len(priceFacetBounds))
+	for i, bound := range priceFacetBounds {
+		bounds[i] = strconv.Itoa(bound)
+	}
+
+	var priceRows []priceBucketRow
+	priceQuery, err := shared.ApplyCriteria(r.db(ctx).Model(&Product{}), ProductSchema, filters)
+	if err != nil {
+		return nil, err
+	}
+	err = priceQuery.
+		Select("width_bucket(products.price, ARRAY[" + strings.Join(bounds, ",") + "]::numeric[]) AS bucket, COUNT(*) AS count").
+		Group("bucket").
+		Scan(&priceRows).Error
+	if err != nil {
+		log.Printf("Error counting price facets %+v: %v", criteria, err)
+		return nil, fmt.Errorf("failed to count price facets: %w", err)
+	}
+	facets.Price = priceFacets(priceRows)
+
+	var stockRows []stockRow
+	stockQuery, err := shared.ApplyCriteria(r.db(ctx).Model(&Product{}), ProductSchema, filters)
+	if err != nil {
+		return nil, err
+	}
+	err = stockQuery.
+		Select("products.stock > 0 AS in_stock, COUNT(*) AS count").
+		Group("in_stock").
+		Scan(&stockRows).Error
+	if err != nil {
+		log.Printf("Error counting stock facets %+v: %v", criteria, err)
+		return nil, fmt.Errorf("failed to count stock facets: %w", err)
+	}
+	facets.Stock = stockFacets(stockRows)
+
+	if facets.Categories == nil {
+		facets.Categories = []CategoryFacet{}
+	}
+
+	return facets, nil
+}
+
+// Search runs a prefix aware full text search over name and description ranked by relevance,
+// the criteria filter and paginate the matches
+func (r *ProductRepository) Search(ctx context.Context, q string, criteria []shared.Criterion) ([]ProductSearchResult, int64, error) {
+	results := make([]ProductSearchResult, 0)
+	var total int64
+
+	tsquery := toPrefixTSQuery(q)
+	if tsquery == "" {
+		return results, 0, nil
+	}
+
+	matches := func() *gorm.DB {
+		return r.db(ctx).Model(&Product{}).
+			Joins("CROSS JOIN to_tsquery(?::regconfig, ?) AS query", r.searchLanguage, tsquery).
+			Where("products.search_vector @@ query")
+	}
+
+	countQuery, err := shared.ApplyCriteria(matches(), ProductSchema, shared.WithoutPagination(criteria))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := countQuery.Count(&total).Error; err != nil {
+		log.Printf("Error counting product search %q %+v: %v", q, criteria, err)
+		return nil, 0, fmt.Errorf("failed to count product search: %w", err)
+	}
+
+	query, err := shared.ApplyCriteria(matches().Order("rank DESC"), ProductSchema, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rows []productSearchRow
+	err = query.Select(`products.id,
+		ts_rank(products.search_vector, query) AS rank,
+		ts_headline(?::regconfig, products.name, query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS name_highlight,
+		ts_headline(?::regconfig, products.description, query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2') AS description_highlight`,
+		r.searchLanguage, r.searchLanguage,
+	).Scan(&rows).Error
+
+	if err != nil {
+		log.Printf("Error searching products %q %+v: %v", q, criteria, err)
+		return nil, 0, fmt.Errorf("failed to search products: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return results, total, nil
 	}
 
-	return products, nil
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+
+	var products []Product
+	if err := r.db(ctx).Scopes(shared.TenantScope("products")).Preload("Categories").Find(&products, ids).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch searched products: %w", err)
+	}
+
+	byID := make(map[uint]Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	for _, row := range rows {
+		product, found := byID[row.ID]
+		if !found {
+			continue
+		}
+		results = append(results, ProductSearchResult{
+			Product:              product,
+			Rank:                 row.Rank,
+			NameHighlight:        row.NameHighlight,
+			DescriptionHighlight: row.DescriptionHighlight,
+		})
+	}
+
+	return results, total, nil
 }
 
-func (r *ProductRepository) FindByID(id uint) (*Product, error) {
+func (r *ProductRepository) FindByID(ctx context.Context, id uint) (*Product, error) {
 	var product Product
-	if err := r.DB.Preload("Categories").First(&product, id).Error; err != nil {
+	if err := r.db(ctx).Scopes(shared.TenantScope("products")).Preload("Categories").First(&product, id).Error; err != nil {
 		return nil, err
 	}
 	return &product, nil
 }
 
-func (r *ProductRepository) Update(product *Product) (*Product, error) {
-	if err := r.DB.Save(product).Error; err != nil {
-		return nil, err
+// Update saves every field of the product but its tenant. A product of another tenant is not found, unlike Save
+// which would insert it over the row of the other tenant
+func (r *ProductRepository) Update(ctx context.Context, product *Product) (*Product, error) {
+	result := r.db(ctx).Scopes(shared.TenantScope("products")).Select("*").Omit(clause.Associations, "TenantID").Updates(product)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
 	}
 	return product, nil
 }
 
-func (r *ProductRepository) Delete(id uint) error {
-	return r.DB.Delete(&Product{}, id).Error
+func (r *ProductRepository) Delete(ctx context.Context, id uint) error {
+	return r.db(ctx).Scopes(shared.TenantScope("products")).Delete(&Product{}, id).Error
+}
+
+func (r *ProductRepository) FindTrashed(ctx context.Context, criteria []shared.Criterion) ([]Product, int64, error) {
+	var products []Product
+	var total int64
+
+	trashed := func() *gorm.DB {
+		return r.db(ctx).Unscoped().Model(&Product{}).Where("deleted_at IS NOT NULL")
+	}
+
+	countQuery, err := shared.ApplyCriteria(trashed(), ProductSchema, shared.WithoutPagination(criteria))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := countQuery.Count(&total).Error; err != nil {
+		log.Printf("Error counting trashed products %+v: %v", criteria, err)
+		return nil, 0, fmt.Errorf("failed to count trashed products: %w", err)
+	}
+
+	query, err := shared.ApplyCriteria(trashed().Preload("Categories"), ProductSchema, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Find(&products).Error
+
+	if err != nil {
+		log.Printf("Error fetching trashed products %+v: %v", criteria, err)
+		return nil, 0, fmt.Errorf("failed to fetch trashed products: %w", err)
+	}
+
+	return products, total, nil
+}
+
+func (r *ProductRepository) FindTrashedByID(ctx context.Context, id uint) (*Product, error) {
+	var product Product
+	if err := r.db(ctx).Unscoped().Scopes(shared.TenantScope("products")).Where("deleted_at IS NOT NULL").First(&product, id).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// FindByIDWithTrashed returns the product whether it is in the trash or not
+func (r *ProductRepository) FindByIDWithTrashed(ctx context.Context, id uint) (*Product, error) {
+	var product Product
+	if err := r.db(ctx).Unscoped().Scopes(shared.TenantScope("products")).Preload("Categories").First(&product, id).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// FindAllAsOf lists the products that existed at the given time: created by then and not yet in the trash.
+// Only the pagination criteria are meaningful, the rows hold their current values
+func (r *ProductRepository) FindAllAsOf(ctx context.Context, asOf time.Time, criteria []shared.Criterion) ([]Product, int64, error) {
+	var products []Product
+	var total int64
+
+	existing := func() *gorm.DB {
+		return r.db(ctx).Unscoped().Model(&Product{}).
+			Where("created_at <= ? AND (deleted_at IS NULL OR deleted_at > ?)", asOf, asOf)
+	}
+
+	countQuery, err := shared.ApplyCriteria(existing(), ProductSchema, shared.WithoutPagination(criteria))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := countQuery.Count(&total).Error; err != nil {
+		log.Printf("Error counting products as of %s: %v", asOf, err)
+		return nil, 0, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	query, err := shared.ApplyCriteria(existing().Preload("Categories"), ProductSchema, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Find(&products).Error; err != nil {
+		log.Printf("Error fetching products as of %s: %v", asOf, err)
+		return nil, 0, fmt.Errorf("failed to fetch products: %w", err)
+	}
+
+	return products, total, nil
+}
+
+// Restore takes the product out of the trash, a product of another tenant or not in the trash is not found
+func (r *ProductRepository) Restore(ctx context.Context, id uint) error {
+	result := r.db(ctx).Unscoped().Model(&Product{}).Scopes(shared.TenantScope("products")).
+		Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Purge permanently removes a product along with its category links. The history is kept, product_histories
+// has no foreign key on the products so it still tells what happened to the product
+func (r *ProductRepository) Purge(ctx context.Context, id uint) error {
+	return r.db(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Scopes(shared.TenantScope("products")).Select("id").First(&Product{}, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("product_id = ?", id).Delete(&ProductCategories{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&Product{}, id).Error
+	})
 }
 
-func (r *ProductRepository) UpdateCategories(product *Product, categories []categories.Categories) error {
-	return r.DB.Model(&product).Association("Categories").Replace(categories)
+// FindCategories returns the categories of the tenant with the given IDs, the IDs of other tenants are ignored
+func (r *ProductRepository) FindCategories(ctx context.Context, ids []uint) ([]categories.Categories, error) {
+	var cats []categories.Categories
+	if len(ids) == 0 {
+		return cats, nil
+	}
+	err := r.db(ctx).Scopes(shared.TenantScope("categories")).Find(&cats, ids).Error
+	return cats, err
+}
+
+// UpdateCategories replaces the categories linked to the product, the links are owned by the tenant of the product
+func (r *ProductRepository) UpdateCategories(ctx context.Context, product *Product, categories []categories.Categories) error {
+	ids := make([]uint, len(categories))
+	for i, category := range categories {
+		ids[i] = category.ID
+	}
+
+	err := r.db(ctx).Transaction(func(tx *gorm.DB) error {
+		unlink := tx.Where("product_id = ?", product.ID)
+		if len(ids) > 0 {
+			unlink = unlink.Where("category_id NOT IN ?", ids)
+		}
+		if err := unlink.Delete(&ProductCategories{}).Error; err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		links := make([]ProductCategories, len(ids))
+		for i, id := range ids {
+			links[i] = ProductCategories{ProductID: product.ID, CategoryID: id, TenantID: product.TenantID}
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_id"}, {Name: "category_id"}},
+			DoUpdates: clause.Assignments(map[string]any{"deleted_at": nil}),
+		}).Create(&links).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	product.Categories = categories
+	return nil
 }
 
-func (r *ProductRepository) FindHistoryByProductID(productID uint, start, end *time.Time) ([]ProductHistory, error) {
+func (r *ProductRepository) FindHistoryByProductID(ctx context.Context, productID uint, filter ProductHistoryFilter) ([]ProductHistory, error) {
 	var histories []ProductHistory
-	query := r.DB.Model(&ProductHistory{}).Where("product_id = ?", productID).Preload("Details")
-	if start != nil {
-		query = query.Where("changed_at >= ?", *start)
+	query := r.db(ctx).Model(&ProductHistory{}).Scopes(shared.TenantScope("product_histories")).Where("product_id = ?", productID).
+		Preload("Details", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+	if filter.Start != nil {
+		query = query.Where("changed_at >= ?", *filter.Start)
+	}
+	if filter.End != nil {
+		query = query.Where("changed_at <= ?", *filter.End)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
 	}
-	if end != nil {
-		query = query.Where("changed_at <= ?", *end)
+	if filter.ActorType != "" {
+		query = query.Where("actor_type = ?", filter.ActorType)
 	}
 	err := query.Order("changed_at DESC").Find(&histories).Error
 	return histories, err
 }
+
+// FindHistoryUntil returns the history recorded up to end of each of the products, in a single query
+func (r *ProductRepository) FindHistoryUntil(ctx context.Context, productIDs []uint, end time.Time) (map[uint][]ProductHistory, error) {
+	byProduct := make(map[uint][]ProductHistory, len(productIDs))
+	if len(productIDs) == 0 {
+		return byProduct, nil
+	}
+
+	var histories []ProductHistory
+	err := r.db(ctx).Scopes(shared.TenantScope("product_histories")).
+		Preload("Details", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("product_id IN ? AND changed_at <= ?", productIDs, end).
+		Order("changed_at, id").
+		Find(&histories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, history := range histories {
+		byProduct[history.ProductID] = append(byProduct[history.ProductID], history)
+	}
+	return byProduct, nil
+}
+
+// FindHistoryByUUID returns a history entry of the product with its details in the order they were recorded
+func (r *ProductRepository) FindHistoryByUUID(ctx context.Context, productID uint, historyUUID uuid.UUID) (*ProductHistory, error) {
+	var history ProductHistory
+	err := r.db(ctx).
+		Scopes(shared.TenantScope("product_histories")).
+		Preload("Details", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("product_id = ? AND uuid = ?", productID, historyUUID).
+		First(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
@@ -0,0 +1,148 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/Javieradel/api-qisur.git/src/shared/sqltest"
+	"gorm.io/gorm"
+)
+
+const (
+	tenantA uint = 7
+	tenantB uint = 8
+)
+
+// productOfTenantB is the ID of a product owned by tenant B, the fake database finds no row for it
+// when the queries are restricted to tenant A
+const productOfTenantB uint = 42
+
+// tenantStatements returns the statements reading or writing the products table
+func tenantStatements(fake *sqltest.DB) []sqltest.Statement {
+	var statements []sqltest.Statement
+	for _, statement := range fake.Statements() {
+		if strings.Contains(statement.SQL, `FROM "products"`) || strings.Contains(statement.SQL, `UPDATE "products"`) {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+var repositoryCalls = []struct {
+	name string
+	run  func(ctx context.Context, repo *ProductRepository, id uint) error
+}{
+	{"FindByID", func(ctx context.Context, repo *ProductRepository, id uint) error {
+		_, err := repo.FindByID(ctx, id)
+		return err
+	}},
+	{"FindAll", func(ctx context.Context, repo *ProductRepository, _ uint) error {
+		_, _, err := repo.FindAll(ctx, []shared.Criterion{{Operator: shared.OpLimit, Value: 10}})
+		return err
+	}},
+	{"Update", func(ctx context.Context, repo *ProductRepository, id uint) error {
+		_, err := repo.Update(ctx, &Product{ID: id, TenantID: tenantB, Name: "taken over"})
+		return err
+	}},
+	{"Delete", func(ctx context.Context, repo *ProductRepository, id uint) error {
+		return repo.Delete(ctx, id)
+	}},
+	{"Restore", func(ctx context.Context, repo *ProductRepository, id uint) error {
+		return repo.Restore(ctx, id)
+	}},
+	{"Purge", func(ctx context.Context, repo *ProductRepository, id uint) error {
+		return repo.Purge(ctx, id)
+	}},
+}
+
+func TestProductRepositoryIsolatesTenants(t *testing.T) {
+	for _, call := range repositoryCalls {
+		t.Run(call.name, func(t *testing.T) {
+			db, fake := sqltest.Open()
+			fake.Affect(`UPDATE "products"`, 0)
+			err := call.run(shared.WithTenant(context.Background(), tenantA), NewProductRepository(db), productOfTenantB)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatal(err)
+			}
+
+			statements := tenantStatements(fake)
+			if len(statements) == 0 {
+				t.Fatal("no statement on products")
+			}
+			for _, statement := range statements {
+				if !statement.Compares(`"products"."tenant_id"`, int64(tenantA)) {
+					t.Errorf("not restricted to tenant A: %s %v", statement.SQL, statement.Args)
+				}
+				if strings.Contains(statement.SQL, `"tenant_id"=`) {
+					t.Errorf("tenant changed: %s %v", statement.SQL, statement.Args)
+				}
+			}
+			if fake.Ran("INSERT") || fake.Ran("DELETE") {
+				t.Errorf("the product of tenant B was written: %v", fake.Statements())
+			}
+		})
+	}
+}
+
+func TestProductRepositoryUpdateOfAnotherTenantIsNotFound(t *testing.T) {
+	db, fake := sqltest.Open()
+	fake.Affect(`UPDATE "products"`, 0)
+
+	product := &Product{ID: productOfTenantB, TenantID: tenantB, Name: "taken over"}
+	_, err := NewProductRepository(db).Update(shared.WithTenant(context.Background(), tenantA), product)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("error = %v, want gorm.ErrRecordNotFound", err)
+	}
+	// Save would upsert the row of tenant B when the update matches no row
+	if fake.Ran("INSERT") || fake.Ran("ON CONFLICT") {
+		t.Fatalf("the product was upserted: %v", fake.Statements())
+	}
+}
+
+func TestProductRepositoryRestoreOfAnotherTenantIsNotFound(t *testing.T) {
+	db, fake := sqltest.Open()
+	fake.Affect(`UPDATE "products"`, 0)
+
+	err := NewProductRepository(db).Restore(shared.WithTenant(context.Background(), tenantA), productOfTenantB)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("error = %v, want gorm.ErrRecordNotFound", err)
+	}
+	if restore := fake.Matching(`UPDATE "products"`); len(restore) != 1 || !strings.Contains(restore[0].SQL, "deleted_at IS NOT NULL") {
+		t.Fatalf("restored %v, want only a product in the trash", restore)
+	}
+}
+
+func TestProductRepositoryPurgesOnlyProductsOfTheTenant(t *testing.T) {
+	db, fake := sqltest.Open()
+	fake.Return(`SELECT "id" FROM "products"`, []string{"id"}, []any{int64(1)})
+
+	if err := NewProductRepository(db).Purge(shared.WithTenant(context.Background(), tenantA), 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, fragment := range []string{`DELETE FROM "product_categories"`, `DELETE FROM "products"`} {
+		if !fake.Ran(fragment) {
+			t.Errorf("%s not run", fragment)
+		}
+	}
+	if fake.Ran(`DELETE FROM "product_history`) {
+		t.Errorf("the history was deleted: %v", fake.Statements())
+	}
+}
+
+func TestProductRepositoryRequiresTenant(t *testing.T) {
+	for _, call := range repositoryCalls {
+		t.Run(call.name, func(t *testing.T) {
+			db, fake := sqltest.Open()
+			err := call.run(context.Background(), NewProductRepository(db), 1)
+			if !errors.Is(err, shared.ErrTenantRequired) {
+				t.Fatalf("error = %v, want shared.ErrTenantRequired", err)
+			}
+			if statements := tenantStatements(fake); len(statements) > 0 || fake.Ran("INSERT") {
+				t.Fatalf("ran without a tenant: %v", fake.Statements())
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package products
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+const defaultSearchLanguage = "english"
+
+var searchLanguagePattern = regexp.MustCompile(`^[a-z_]+$`)
+
+// ProductSearchResult is a product matching a full text search with its relevance and highlighted snippets
+type ProductSearchResult struct {
+	Product
+	Rank                 float64 `json:"rank"`
+	NameHighlight        string  `json:"name_highlight"`
+	DescriptionHighlight string  `json:"description_highlight"`
+}
+
+// productSearchRow holds the ranking columns read before loading the matched products
+type productSearchRow struct {
+	ID                   uint
+	Rank                 float64
+	NameHighlight        string
+	DescriptionHighlight string
+}
+
+// SearchLanguage returns the Postgres text search configuration set in SEARCH_LANGUAGE, english by default
+func SearchLanguage() string {
+	language := strings.ToLower(os.Getenv("SEARCH_LANGUAGE"))
+	if !searchLanguagePattern.MatchString(language) {
+		return defaultSearchLanguage
+	}
+	return language
+}
+
+// MigrateSearch adds the generated search_vector column weighting the name over the description
+// and its GIN index. The language is only applied when the column is created
+func MigrateSearch(db *gorm.DB, language string) error {
+	if !searchLanguagePattern.MatchString(language) {
+		return fmt.Errorf("invalid search language %q", language)
+	}
+
+	err := db.Exec(fmt.Sprintf(`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('%[1]s', coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('%[1]s', coalesce(description, '')), 'B')
+		) STORED`, language)).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)").Error
+}
+
+// toPrefixTSQuery turns the user input into a tsquery matching every word as a prefix, e.g. "red cha" => "red:* & cha:*"
+func toPrefixTSQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, strings.ToLower(word)+":*")
+	}
+	return strings.Join(terms, " & ")
+}
@@ -1,68 +1,284 @@
 package products
 
 import (
+	"context"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/Javieradel/api-qisur.git/src/categories"
 	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type ProductService struct {
-	repo     *ProductRepository
-	eventBus *shared.EventBus
+	repo       *ProductRepository
+	unitOfWork *shared.UnitOfWork
+	eventBus   *shared.EventBus
 }
 
-func NewProductService(repo *ProductRepository, eventBus *shared.EventBus) *ProductService {
-	return &ProductService{repo: repo, eventBus: eventBus}
+func NewProductService(repo *ProductRepository, unitOfWork *shared.UnitOfWork, eventBus *shared.EventBus) *ProductService {
+	return &ProductService{repo: repo, unitOfWork: unitOfWork, eventBus: eventBus}
 }
 
-func (s *ProductService) FindAll(filters []shared.Criterion) ([]Product, error) {
-	return s.repo.FindAll(filters)
+// InTransaction runs fn in a single transaction, the service calls made with the context given to fn
+// are committed together with their history or not at all
+func (s *ProductService) InTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.unitOfWork.Do(ctx, fn)
 }
 
-func (s *ProductService) FindByID(id uint) (*Product, error) {
-	return s.repo.FindByID(id)
+func (s *ProductService) FindAll(ctx context.Context, filters []shared.Criterion) ([]Product, int64, error) {
+	return s.repo.FindAll(ctx, filters)
 }
 
-func (s *ProductService) Create(product *Product) (*Product, error) {
-	if err := s.repo.Create(product); err != nil {
+func (s *ProductService) Facets(ctx context.Context, filters []shared.Criterion) (*ProductFacets, error) {
+	return s.repo.Facets(ctx, filters)
+}
+
+func (s *ProductService) Search(ctx context.Context, q string, filters []shared.Criterion) ([]ProductSearchResult, int64, error) {
+	return s.repo.Search(ctx, q, filters)
+}
+
+func (s *ProductService) FindByID(ctx context.Context, id uint) (*Product, error) {
+	return s.repo.FindByID(ctx, id)
+}
+
+// Create stores the product and its history in a single transaction, the actor of the context is recorded
+// as the author of the change
+func (s *ProductService) Create(ctx context.Context, product *Product) (*Product, error) {
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, product); err != nil {
+			return err
+		}
+		return s.eventBus.PublishTx(ctx, ProductCreatedEvent{EventMeta: shared.NewEventMeta(), Product: *product, Actor: shared.ActorFrom(ctx)})
+	})
+	if err != nil {
 		return nil, err
 	}
-	s.eventBus.Publish(ProductCreatedEvent{Product: *product})
 	return product, nil
 }
 
-func (s *ProductService) Update(product *Product) (*Product, error) {
-	oldProduct, err := s.repo.FindByID(product.ID)
+// Update stores the product and its history in a single transaction, the actor of the context is recorded
+// as the author of the change
+func (s *ProductService) Update(ctx context.Context, product *Product) (*Product, error) {
+	var updatedProduct *Product
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		oldProduct, err := s.repo.FindByID(ctx, product.ID)
+		if err != nil {
+			return err
+		}
+		// the tenant of a product never changes, the one of the stored row wins
+		product.TenantID = oldProduct.TenantID
+		if updatedProduct, err = s.repo.Update(ctx, product); err != nil {
+			return err
+		}
+		return s.eventBus.PublishTx(ctx, ProductUpdatedEvent{EventMeta: shared.NewEventMeta(), OldProduct: *oldProduct, NewProduct: *updatedProduct, Actor: shared.ActorFrom(ctx)})
+	})
 	if err != nil {
 		return nil, err
 	}
-	updatedProduct, err := s.repo.Update(product)
+	return updatedProduct, nil
+}
+
+// UpdateCategories replaces the categories of the product and records the ones added and removed, if any,
+// in a single transaction
+func (s *ProductService) UpdateCategories(ctx context.Context, product *Product, categoriesID []uint) error {
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		current, err := s.repo.FindByID(ctx, product.ID)
+		if err != nil {
+			return err
+		}
+		cats, err := s.repo.FindCategories(ctx, categoriesID)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.UpdateCategories(ctx, product, cats); err != nil {
+			return err
+		}
+
+		added, removed := diffCategories(current.Categories, cats)
+		if len(added) == 0 && len(removed) == 0 {
+			return nil
+		}
+		return s.eventBus.PublishTx(ctx, ProductCategoriesUpdatedEvent{EventMeta: shared.NewEventMeta(), Product: *product, Added: added, Removed: removed, Actor: shared.ActorFrom(ctx)})
+	})
+}
+
+func (s *ProductService) Delete(ctx context.Context, id uint) error {
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		tenantID, _ := shared.TenantFrom(ctx)
+		return s.eventBus.PublishTx(ctx, ProductDeletedEvent{EventMeta: shared.NewEventMeta(), ProductID: id, TenantID: tenantID, Actor: shared.ActorFrom(ctx)})
+	})
+}
+
+func (s *ProductService) FindTrashed(ctx context.Context, filters []shared.Criterion) ([]Product, int64, error) {
+	return s.repo.FindTrashed(ctx, filters)
+}
+
+func (s *ProductService) FindTrashedByID(ctx context.Context, id uint) (*Product, error) {
+	return s.repo.FindTrashedByID(ctx, id)
+}
+
+func (s *ProductService) Restore(ctx context.Context, id uint) error {
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		product, err := s.repo.FindTrashedByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+		deletedAt := product.DeletedAt.Time
+		product.DeletedAt = gorm.DeletedAt{}
+		return s.eventBus.PublishTx(ctx, ProductRestoredEvent{EventMeta: shared.NewEventMeta(), Product: *product, DeletedAt: deletedAt, Actor: shared.ActorFrom(ctx)})
+	})
+}
+
+// Purge permanently removes the product, its history is kept and ends with the purge
+func (s *ProductService) Purge(ctx context.Context, id uint) error {
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Purge(ctx, id); err != nil {
+			return err
+		}
+		tenantID, _ := shared.TenantFrom(ctx)
+		return s.eventBus.PublishTx(ctx, ProductPurgedEvent{EventMeta: shared.NewEventMeta(), ProductID: id, TenantID: tenantID, Actor: shared.ActorFrom(ctx)})
+	})
+}
+
+func (s *ProductService) FindHistoryByProductID(ctx context.Context, productID uint, filter ProductHistoryFilter) ([]ProductHistory, error) {
+	return s.repo.FindHistoryByProductID(ctx, productID, filter)
+}
+
+// FindByIDAsOf rebuilds the product as it was at the given time by replaying its history up to it.
+// A product created after that time, or already in the trash then, is not found
+func (s *ProductService) FindByIDAsOf(ctx context.Context, id uint, asOf time.Time) (*Product, error) {
+	product, err := s.repo.FindByIDWithTrashed(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	s.eventBus.Publish(ProductUpdatedEvent{OldProduct: *oldProduct, NewProduct: *updatedProduct})
-	return updatedProduct, nil
+	if !existedAt(*product, asOf) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	histories, err := s.repo.FindHistoryByProductID(ctx, id, ProductHistoryFilter{End: &asOf})
+	if err != nil {
+		return nil, err
+	}
+	rebuilt, _, err := rebuildProduct(*product, histories)
+	if err != nil {
+		return nil, err
+	}
+	return &rebuilt, nil
 }
 
-func (s *ProductService) UpdateCategories(product *Product, categoriesID []uint) error {
-	var cats []categories.Categories
-	if len(categoriesID) > 0 {
-		if err := s.repo.DB.Find(&cats, categoriesID).Error; err != nil {
-			return err
+// FindAllAsOf lists the catalog as it was at the given time, each product of the page is rebuilt from its history
+func (s *ProductService) FindAllAsOf(ctx context.Context, asOf time.Time, criteria []shared.Criterion) ([]Product, int64, error) {
+	products, total, err := s.repo.FindAllAsOf(ctx, asOf, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	histories, err := s.repo.FindHistoryUntil(ctx, ids, asOf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i, product := range products {
+		if products[i], _, err = rebuildProduct(product, histories[product.ID]); err != nil {
+			return nil, 0, fmt.Errorf("product %d: %w", product.ID, err)
 		}
 	}
-	return s.repo.UpdateCategories(product, cats)
+	return products, total, nil
 }
 
-func (s *ProductService) Delete(id uint) error {
-	if err := s.repo.Delete(id); err != nil {
-		return err
+// HistoryPatch returns a history entry of the product as a JSON Patch
+func (s *ProductService) HistoryPatch(ctx context.Context, productID uint, historyUUID uuid.UUID) ([]shared.PatchOperation, error) {
+	history, err := s.repo.FindHistoryByUUID(ctx, productID, historyUUID)
+	if err != nil {
+		return nil, err
 	}
-	s.eventBus.Publish(ProductDeletedEvent{ProductID: id})
-	return nil
+	return history.JSONPatch()
 }
 
-func (s *ProductService) FindHistoryByProductID(productID uint, start, end *time.Time) ([]ProductHistory, error) {
-	return s.repo.FindHistoryByProductID(productID, start, end)
+// Revert rebuilds the product as it was right after the history entry and stores it through Update and
+// UpdateCategories in a single transaction, so the revert is recorded in the history too.
+// A dry run only returns the changes it would make
+func (s *ProductService) Revert(ctx context.Context, productID uint, historyUUID uuid.UUID, dryRun bool) (*ProductRevert, error) {
+	current, err := s.repo.FindByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.repo.FindHistoryByUUID(ctx, productID, historyUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	end := target.ChangedAt
+	histories, err := s.repo.FindHistoryByProductID(ctx, productID, ProductHistoryFilter{End: &end})
+	if err != nil {
+		return nil, err
+	}
+	// entries recorded at the same time as the target but after it aren't part of the revision
+	histories = slices.DeleteFunc(histories, func(h ProductHistory) bool {
+		return h.ChangedAt.Equal(target.ChangedAt) && h.ID > target.ID
+	})
+
+	reverted, _, err := rebuildProduct(*current, histories)
+	if err != nil {
+		return nil, err
+	}
+
+	revert := &ProductRevert{Product: reverted, Changes: shared.DiffFields(*current, reverted), DryRun: dryRun}
+	revert.AddedCategories, revert.RemovedCategories = diffCategories(current.Categories, reverted.Categories)
+	if dryRun {
+		return revert, nil
+	}
+
+	err = s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if len(revert.Changes) > 0 {
+			if _, err := s.Update(ctx, &reverted); err != nil {
+				return err
+			}
+		}
+		if len(revert.AddedCategories) > 0 || len(revert.RemovedCategories) > 0 {
+			// never nil, reverting to a revision without categories unlinks them all
+			categoryIDs := make([]uint, 0, len(reverted.Categories))
+			for _, category := range reverted.Categories {
+				categoryIDs = append(categoryIDs, category.ID)
+			}
+			return s.UpdateCategories(ctx, &reverted, categoryIDs)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	revert.Product = reverted
+	return revert, nil
+}
+
+// diffCategories returns the categories of after missing in before and the ones of before missing in after
+func diffCategories(before, after []categories.Categories) (added, removed []CategoryRef) {
+	contains := func(cats []categories.Categories, id uint) bool {
+		return slices.ContainsFunc(cats, func(c categories.Categories) bool { return c.ID == id })
+	}
+	for _, category := range after {
+		if !contains(before, category.ID) {
+			added = append(added, CategoryRef{ID: category.ID, Name: category.Name})
+		}
+	}
+	for _, category := range before {
+		if !contains(after, category.ID) {
+			removed = append(removed, CategoryRef{ID: category.ID, Name: category.Name})
+		}
+	}
+	return added, removed
 }
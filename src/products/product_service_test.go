@@ -0,0 +1,280 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/Javieradel/api-qisur.git/src/shared/sqltest"
+	"github.com/shopspring/decimal"
+)
+
+var errInjected = errors.New("injected failure")
+
+// eventRecorder is a listener recording the events published once committed
+type eventRecorder struct {
+	events chan shared.Event
+}
+
+func (r *eventRecorder) Handle(event shared.Event) error {
+	r.events <- event
+	return nil
+}
+
+// assertNoEvent fails when an event is published within a grace period, the listeners run in the background
+func (r *eventRecorder) assertNoEvent(t *testing.T) {
+	t.Helper()
+	select {
+	case event := <-r.events:
+		t.Fatalf("%s published", event.Topic())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// newTestService returns the product service on a fake database holding product 1 of tenant A,
+// with the history recorded in the transaction and a recorder of the published events
+func newTestService(t *testing.T) (*ProductService, *sqltest.DB, *eventRecorder) {
+	t.Helper()
+	db, fake := sqltest.Open()
+	if err := SetupJoinTables(db); err != nil {
+		t.Fatal(err)
+	}
+	fake.Return(`INSERT INTO "products"`, []string{"id"}, []any{int64(1)})
+	fake.Return(`FROM "products"`,
+		[]string{"id", "tenant_id", "name", "price", "stock"},
+		[]any{int64(1), int64(tenantA), "Lamp", "10.50", int64(3)},
+	)
+	fake.Return(`FROM "categories"`, []string{"id", "tenant_id", "name"}, []any{int64(5), int64(tenantA), "Lighting"})
+	fake.Return(`INSERT INTO "product_histories"`, []string{"id"}, []any{int64(9)})
+
+	bus := shared.NewEventBus()
+	historyListener := NewProductHistoryListener(db)
+	recorder := &eventRecorder{events: make(chan shared.Event, 10)}
+	for _, topic := range []string{"product.created", "product.updated", "product.categories_updated", "product.deleted", "product.restored", "product.purged"} {
+		bus.SubscribeTx(topic, historyListener)
+		bus.Subscribe(topic, recorder)
+	}
+	return NewProductService(NewProductRepository(db), shared.NewUnitOfWork(db), bus), fake, recorder
+}
+
+// assertRolledBack fails unless the writes ran in a single transaction rolled back
+func assertRolledBack(t *testing.T, fake *sqltest.DB, writes ...string) {
+	t.Helper()
+	var log []string
+	for _, statement := range fake.Statements() {
+		log = append(log, statement.SQL)
+	}
+	if len(log) == 0 || log[0] != sqltest.Begin || log[len(log)-1] != sqltest.Rollback {
+		t.Fatalf("statements = %q, want them in a transaction rolled back", log)
+	}
+	if slices.Contains(log, sqltest.Commit) || slices.Index(log[1:], sqltest.Begin) >= 0 {
+		t.Fatalf("statements = %q, want a single transaction never committed", log)
+	}
+	for _, write := range writes {
+		if !fake.Ran(write) {
+			t.Errorf("%s not run before the rollback", write)
+		}
+	}
+}
+
+func TestProductServiceRollsBackWhenTheHistoryFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		failOn string
+		run    func(ctx context.Context, s *ProductService) error
+		writes []string
+	}{
+		{
+			name:   "create without history",
+			failOn: `INSERT INTO "product_histories"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				_, err := s.Create(ctx, &Product{Name: "Lamp", Price: decimal.RequireFromString("10.50")})
+				return err
+			},
+			writes: []string{`INSERT INTO "products"`},
+		},
+		{
+			name:   "create without history details",
+			failOn: `INSERT INTO "product_history_details"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				_, err := s.Create(ctx, &Product{Name: "Lamp", Price: decimal.RequireFromString("10.50")})
+				return err
+			},
+			writes: []string{`INSERT INTO "products"`, `INSERT INTO "product_histories"`},
+		},
+		{
+			name:   "update without history",
+			failOn: `INSERT INTO "product_histories"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				_, err := s.Update(ctx, &Product{ID: 1, Name: "Desk lamp", Price: decimal.RequireFromString("12")})
+				return err
+			},
+			writes: []string{`UPDATE "products"`},
+		},
+		{
+			name:   "delete without history",
+			failOn: `INSERT INTO "product_histories"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				return s.Delete(ctx, 1)
+			},
+			writes: []string{`UPDATE "products" SET "deleted_at"`},
+		},
+		{
+			name:   "restore without history",
+			failOn: `INSERT INTO "product_histories"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				return s.Restore(ctx, 1)
+			},
+			writes: []string{`UPDATE "products" SET "deleted_at"`},
+		},
+		{
+			name:   "purge without history",
+			failOn: `INSERT INTO "product_histories"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				return s.Purge(ctx, 1)
+			},
+			writes: []string{`DELETE FROM "product_categories"`, `DELETE FROM "products"`},
+		},
+		{
+			name:   "categories without history",
+			failOn: `INSERT INTO "product_histories"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				return s.UpdateCategories(ctx, &Product{ID: 1, TenantID: tenantA}, []uint{5})
+			},
+			writes: []string{`UPDATE "product_categories"`, `INSERT INTO "product_categories"`},
+		},
+		{
+			name:   "categories failing",
+			failOn: `INSERT INTO "product_categories"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				return s.UpdateCategories(ctx, &Product{ID: 1, TenantID: tenantA}, []uint{5})
+			},
+			writes: []string{`UPDATE "product_categories"`},
+		},
+		{
+			name:   "create with categories failing",
+			failOn: `INSERT INTO "product_categories"`,
+			run: func(ctx context.Context, s *ProductService) error {
+				return s.InTransaction(ctx, func(ctx context.Context) error {
+					product, err := s.Create(ctx, &Product{Name: "Lamp", Price: decimal.RequireFromString("10.50")})
+					if err != nil {
+						return err
+					}
+					return s.UpdateCategories(ctx, product, []uint{5})
+				})
+			},
+			writes: []string{`INSERT INTO "products"`, `INSERT INTO "product_histories"`, `INSERT INTO "product_history_details"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, fake, recorder := newTestService(t)
+			fake.Fail(tt.failOn, errInjected)
+
+			err := service.InTransaction(shared.WithTenant(context.Background(), tenantA), func(ctx context.Context) error {
+				shared.AfterCommit(ctx, func() { t.Error("callback run after a rollback") })
+				return tt.run(ctx, service)
+			})
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("error = %v, want the injected failure", err)
+			}
+
+			assertRolledBack(t, fake, append(tt.writes, tt.failOn)...)
+			recorder.assertNoEvent(t)
+		})
+	}
+}
+
+func TestProductServiceCommitsWithTheHistory(t *testing.T) {
+	service, fake, recorder := newTestService(t)
+
+	committed := false
+	err := service.InTransaction(shared.WithTenant(context.Background(), tenantA), func(ctx context.Context) error {
+		shared.AfterCommit(ctx, func() { committed = true })
+		product, err := service.Create(ctx, &Product{Name: "Lamp", Price: decimal.RequireFromString("10.50")})
+		if err != nil {
+			return err
+		}
+		return service.UpdateCategories(ctx, product, []uint{5})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements := fake.Statements()
+	if statements[0].SQL != sqltest.Begin || statements[len(statements)-1].SQL != sqltest.Commit || len(fake.Matching(sqltest.Begin)) != 1 {
+		t.Fatalf("statements = %v, want them in a single transaction committed", statements)
+	}
+	if !committed {
+		t.Fatal("callback not run after the commit")
+	}
+
+	var topics []string
+	for range 2 {
+		select {
+		case event := <-recorder.events:
+			topics = append(topics, event.Topic())
+		case <-time.After(time.Second):
+			t.Fatalf("published %v, want the creation and the categories update", topics)
+		}
+	}
+	slices.Sort(topics)
+	if !slices.Equal(topics, []string{"product.categories_updated", "product.created"}) {
+		t.Fatalf("published %v, want the creation and the categories update", topics)
+	}
+}
+
+func TestProductServiceRecordsTheTrashLifecycle(t *testing.T) {
+	deletedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		topic string
+		run   func(ctx context.Context, s *ProductService) error
+		field string
+		value *shared.HistoryValue
+	}{
+		{"product.deleted", func(ctx context.Context, s *ProductService) error { return s.Delete(ctx, 1) }, shared.HistoryFieldDeletedAt, nil},
+		{"product.restored", func(ctx context.Context, s *ProductService) error { return s.Restore(ctx, 1) }, shared.HistoryFieldDeletedAt, shared.NewHistoryValue(deletedAt)},
+		{"product.purged", func(ctx context.Context, s *ProductService) error { return s.Purge(ctx, 1) }, shared.HistoryFieldPurgedAt, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			service, fake, recorder := newTestService(t)
+			fake.Return(`FROM "products" WHERE deleted_at IS NOT NULL`,
+				[]string{"id", "tenant_id", "name", "deleted_at"},
+				[]any{int64(1), int64(tenantA), "Lamp", deletedAt},
+			)
+
+			if err := tt.run(shared.WithTenant(context.Background(), tenantA), service); err != nil {
+				t.Fatal(err)
+			}
+
+			statements := fake.Statements()
+			if statements[0].SQL != sqltest.Begin || statements[len(statements)-1].SQL != sqltest.Commit || len(fake.Matching(sqltest.Begin)) != 1 {
+				t.Fatalf("statements = %v, want them in a single transaction committed", statements)
+			}
+			details := fake.Matching(`INSERT INTO "product_history_details"`)
+			if len(details) != 1 || !slices.Contains(details[0].Args, any(tt.field)) {
+				t.Fatalf("details %v, want a %s detail", details, tt.field)
+			}
+			if tt.value != nil {
+				if old, _ := tt.value.Value(); details[0].Args[2] != old {
+					t.Fatalf("old value = %v, want %v", details[0].Args[2], old)
+				}
+			}
+			if fake.Ran(`DELETE FROM "product_history`) {
+				t.Fatalf("the history was deleted: %v", statements)
+			}
+			select {
+			case event := <-recorder.events:
+				if event.Topic() != tt.topic {
+					t.Fatalf("published %s, want %s", event.Topic(), tt.topic)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s not published", tt.topic)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/fasthttp/websocket"
+)
+
+// Client is a WebSocket connection subscribed to some topics of its tenant
+type Client struct {
+	hub         *Hub
+	conn        *websocket.Conn
+	send        chan []byte
+	tenantID    uint
+	permissions []shared.Permission
+
+	mu     sync.RWMutex
+	topics map[string]struct{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newClient(hub *Hub, conn *websocket.Conn, principal *shared.Principal, tenantID uint) *Client {
+	return &Client{
+		hub:         hub,
+		conn:        conn,
+		send:        make(chan []byte, sendBuffer),
+		tenantID:    tenantID,
+		permissions: principal.Permissions,
+		topics:      make(map[string]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (c *Client) Subscribed(topic string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, found := c.topics[topic]
+	return found
+}
+
+// Send queues a message without blocking, a client that can't keep up is disconnected
+// so it never slows down the event bus nor the other clients
+func (c *Client) Send(message []byte) {
+	select {
+	case <-c.done:
+	case c.send <- message:
+	default:
+		// closed apart as the hub may be holding its lock while sending
+		go c.close(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+// subscribe adds the topics the client is allowed to receive, failing on the first unknown or forbidden one
+func (c *Client) subscribe(topics []string) ([]string, error) {
+	if err := authorizeTopics(c.permissions, topics); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		c.topics[topic] = struct{}{}
+	}
+	return c.subscriptions(), nil
+}
+
+func (c *Client) unsubscribe(topics []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+	return c.subscriptions()
+}
+
+func (c *Client) subscriptions() []string {
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	slices.Sort(topics)
+	return topics
+}
+
+func (c *Client) reply(message Message) {
+	message.SentAt = time.Now()
+	b, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	c.Send(b)
+}
+
+// readPump handles the subscription messages until the connection fails or stops answering the heartbeats
+func (c *Client) readPump() {
+	defer c.close(websocket.CloseNormalClosure, "")
+
+	c.conn.SetReadLimit(maxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var message ClientMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			c.reply(Message{Type: MessageError, Error: "invalid message"})
+			continue
+		}
+
+		switch message.Action {
+		case ActionSubscribe:
+			topics, err := c.subscribe(message.Topics)
+			if err != nil {
+				c.reply(Message{Type: MessageError, Error: err.Error()})
+				continue
+			}
+			c.reply(Message{Type: MessageSubscribed, Topics: topics})
+		case ActionUnsubscribe:
+			c.reply(Message{Type: MessageUnsubscribed, Topics: c.unsubscribe(message.Topics)})
+		default:
+			c.reply(Message{Type: MessageError, Error: fmt.Sprintf("unknown action %q", message.Action)})
+		}
+	}
+}
+
+// writePump writes the queued messages and the heartbeats, it is the only writer of the connection
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case message := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+// close unregisters the client and closes the connection once, telling the client why when possible
+func (c *Client) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.hub.unregister(c)
+		if code != websocket.CloseAbnormalClosure {
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+		}
+		_ = c.conn.Close()
+	})
+}
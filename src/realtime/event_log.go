@@ -0,0 +1,35 @@
+package realtime
+
+import (
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultEventLogRetention = 7 * 24 * time.Hour
+
+// EventLog is a catalog event persisted so the event stream clients can resume after a disconnection,
+// its ID is the id of the Server-Sent Event
+type EventLog struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	TenantID  uint      `gorm:"index;not null"`
+	// EventID is the idempotency key of the event, an event delivered again is logged once
+	EventID *uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	Topic   string     `gorm:"index;not null"`
+	Payload string     `gorm:"type:jsonb;not null"`
+}
+
+func (EventLog) TableName() string {
+	return "event_logs"
+}
+
+// EventLogRetention returns how long the events are kept, set in EVENT_LOG_RETENTION and a week by default
+func EventLogRetention() time.Duration {
+	retention, err := time.ParseDuration(os.Getenv("EVENT_LOG_RETENTION"))
+	if err != nil || retention <= 0 {
+		return defaultEventLogRetention
+	}
+	return retention
+}
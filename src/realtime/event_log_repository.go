@@ -0,0 +1,42 @@
+package realtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type EventLogRepository struct {
+	DB *gorm.DB
+}
+
+func NewEventLogRepository(db *gorm.DB) *EventLogRepository {
+	return &EventLogRepository{DB: db}
+}
+
+// Create logs the event, it reports false without error when an entry with the same event ID is logged already
+func (r *EventLogRepository) Create(entry *EventLog) (bool, error) {
+	result := r.DB.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).Create(entry)
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindAfter returns the oldest events of the tenant in the context newer than afterID on the given topics
+func (r *EventLogRepository) FindAfter(ctx context.Context, afterID uint, topics []string, limit int) ([]EventLog, error) {
+	var entries []EventLog
+	err := r.DB.WithContext(ctx).
+		Scopes(shared.TenantScope("event_logs")).
+		Where("id > ? AND topic IN ?", afterID, topics).
+		Order("id").
+		Limit(limit).
+		Find(&entries).Error
+	return entries, err
+}
+
+// Prune deletes the events created before the given time
+func (r *EventLogRepository) Prune(before time.Time) (int64, error) {
+	result := r.DB.Where("created_at < ?", before).Delete(&EventLog{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,83 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+// Hub fans out the catalog events of the event bus to the connected clients of the same tenant
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{clients: make(map[*Client]struct{})}
+}
+
+func (*Hub) ListenerName() string {
+	return "realtime.hub"
+}
+
+// Listen subscribes the hub to every topic pushed to the clients
+func (h *Hub) Listen(bus *shared.EventBus) {
+	for topic := range shared.EventTopics {
+		bus.Subscribe(topic, h)
+	}
+}
+
+// Handle pushes the event to the subscribed clients, the ones connected when an event is delivered again
+// receive it twice and discard it by its id
+func (h *Hub) Handle(event shared.Event) error {
+	tenantEvent, ok := event.(shared.TenantEvent)
+	if !ok {
+		return nil
+	}
+
+	var data any = event
+	if payload, ok := event.(shared.PayloadEvent); ok {
+		data = payload.Payload()
+	}
+
+	var id string
+	if identified, ok := event.(shared.IdentifiedEvent); ok {
+		id = identified.EventID().String()
+	}
+
+	message, err := json.Marshal(Message{
+		Type:   MessageEvent,
+		ID:     id,
+		Topic:  event.Topic(),
+		Data:   data,
+		SentAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error encoding realtime event %s: %v", event.Topic(), err)
+		return nil
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if client.tenantID == tenantEvent.Tenant() && client.Subscribed(event.Topic()) {
+			client.Send(message)
+		}
+	}
+	return nil
+}
+
+func (h *Hub) register(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[client] = struct{}{}
+}
+
+func (h *Hub) unregister(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, client)
+}
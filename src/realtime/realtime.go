@@ -0,0 +1,76 @@
+package realtime
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+const (
+	// writeWait is the time allowed to write a message to a client
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed to read the next pong from a client
+	pongWait = 60 * time.Second
+	// pingPeriod sends the heartbeats, it must be shorter than pongWait
+	pingPeriod = pongWait * 9 / 10
+	// sendBuffer is the number of messages queued per client, slow clients that fill it are disconnected
+	sendBuffer = 64
+	// maxMessageSize limits the messages sent by the clients
+	maxMessageSize = 4096
+)
+
+const (
+	MessageEvent        = "event"
+	MessageSubscribed   = "subscribed"
+	MessageUnsubscribed = "unsubscribed"
+	MessageError        = "error"
+
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+)
+
+// Message is sent from the server to the clients
+type Message struct {
+	Type string `json:"type"`
+	// ID identifies the event, the same event may be sent again after a failure
+	ID     string    `json:"id,omitempty"`
+	Topic  string    `json:"topic,omitempty"`
+	Topics []string  `json:"topics,omitempty"`
+	Data   any       `json:"data,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// ClientMessage is sent by the clients to change their subscriptions
+type ClientMessage struct {
+	Action string   `json:"action"`
+	Topics []string `json:"topics"`
+}
+
+// authorizeTopics fails on the first unknown topic or the first one the permissions don't allow
+func authorizeTopics(permissions []shared.Permission, topics []string) error {
+	for _, topic := range topics {
+		permission, found := shared.EventTopics[topic]
+		if !found {
+			return fmt.Errorf("unknown topic %q", topic)
+		}
+		if !slices.Contains(permissions, permission) {
+			return fmt.Errorf("topic %q requires %s permission", topic, permission)
+		}
+	}
+	return nil
+}
+
+// allowedTopics are the topics the permissions allow to receive
+func allowedTopics(permissions []shared.Permission) []string {
+	topics := make([]string, 0, len(shared.EventTopics))
+	for topic, permission := range shared.EventTopics {
+		if slices.Contains(permissions, permission) {
+			topics = append(topics, topic)
+		}
+	}
+	slices.Sort(topics)
+	return topics
+}
@@ -0,0 +1,209 @@
+package realtime
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+type RealtimeController struct {
+	hub      *Hub
+	stream   *Stream
+	upgrader websocket.FastHTTPUpgrader
+}
+
+func NewRealtimeController(hub *Hub, stream *Stream) *RealtimeController {
+	return &RealtimeController{
+		hub:    hub,
+		stream: stream,
+		upgrader: websocket.FastHTTPUpgrader{
+			// The upgrade is authenticated by token, not by cookies, so any origin is allowed like in the CORS config
+			CheckOrigin: func(ctx *fasthttp.RequestCtx) bool { return true },
+		},
+	}
+}
+
+// Routes declares the realtime endpoints, the topics are authorized per subscription
+func (rc *RealtimeController) Routes() []shared.Route {
+	return []shared.Route{
+		{Method: fiber.MethodGet, Path: "/ws", Handler: rc.Connect},
+		{Method: fiber.MethodGet, Path: "/api/v1/events/stream", Handler: rc.Stream},
+	}
+}
+
+func (rc *RealtimeController) RegisterRoutes(app *fiber.App, guard shared.RouteGuard) {
+	shared.RegisterTenantRoutes(app, guard, rc.Routes())
+}
+
+// @Summary Realtime catalog events
+// @Description Upgrades to a WebSocket that pushes the product and category events of the tenant.
+// @Description Browsers can authenticate with the access_token or api_key query params and select the tenant with the tenant query param.
+// @Description Send {"action": "subscribe"|"unsubscribe", "topics": [...]} to change the subscriptions.
+// @Tags realtime
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param topics query string false "Comma separated topics, every topic allowed by the permissions by default"
+// @Success 101 "Switching protocols"
+// @Failure 400 {object} shared.Response "Invalid topics"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 426 {object} shared.Response "Not a WebSocket request"
+// @Router /ws [get]
+func (rc *RealtimeController) Connect(c fiber.Ctx) error {
+	if !shared.IsWebSocketUpgrade(c) {
+		return shared.NewErrorResponse(c, fiber.StatusUpgradeRequired, "WebSocket upgrade required")
+	}
+
+	principal, found := shared.PrincipalFrom(c)
+	if !found {
+		return shared.NewErrorResponse(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	tenantID, found := shared.TenantFrom(c.Context())
+	if !found {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Tenant required")
+	}
+
+	// The fiber context is released once the handler returns, everything the connection needs is taken before
+	client := newClient(rc.hub, nil, principal, tenantID)
+	topics := requestedTopics(c, principal)
+	if len(topics) == 0 {
+		return shared.NewErrorResponse(c, fiber.StatusForbidden, "Forbidden: no topic allowed")
+	}
+	subscribed, err := client.subscribe(topics)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	return rc.upgrader.Upgrade(c.RequestCtx(), func(conn *websocket.Conn) {
+		client.conn = conn
+		rc.hub.register(client)
+		client.reply(Message{Type: MessageSubscribed, Topics: subscribed})
+
+		go client.writePump()
+		client.readPump()
+	})
+}
+
+// @Summary Stream realtime catalog events
+// @Description Server-Sent Events stream of the product and category events of the tenant, for clients that can't use WebSockets.
+// @Description Every event has the id of the event log, reconnecting with the Last-Event-ID header (or last_event_id query param) replays the events missed since then.
+// @Description Browsers can authenticate with the access_token or api_key query params and select the tenant with the tenant query param.
+// @Tags realtime
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param topics query string false "Comma separated topics, every topic allowed by the permissions by default"
+// @Param last_event_id query int false "Resume after this event id"
+// @Param Last-Event-ID header int false "Resume after this event id"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} shared.Response "Invalid topics or last event id"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Router /events/stream [get]
+func (rc *RealtimeController) Stream(c fiber.Ctx) error {
+	principal, found := shared.PrincipalFrom(c)
+	if !found {
+		return shared.NewErrorResponse(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	tenantID, found := shared.TenantFrom(c.Context())
+	if !found {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Tenant required")
+	}
+
+	topics := requestedTopics(c, principal)
+	if len(topics) == 0 {
+		return shared.NewErrorResponse(c, fiber.StatusForbidden, "Forbidden: no topic allowed")
+	}
+	if err := authorizeTopics(principal.Permissions, topics); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	var lastID uint64
+	var err error
+	if value := c.Get("Last-Event-ID", c.Query("last_event_id")); value != "" {
+		lastID, err = strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid last event id")
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	// The fiber context is released once the handler returns, the stream writer runs after it.
+	// Subscribing before replaying ensures no event is lost in between
+	ctx := shared.WithTenant(context.Background(), tenantID)
+	sub := rc.stream.subscribe(tenantID, topics)
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		defer rc.stream.unsubscribe(sub)
+		last := uint(lastID)
+
+		fmt.Fprintf(w, "retry: %d\n\n", retryDelay.Milliseconds())
+		if w.Flush() != nil {
+			return
+		}
+
+		if last > 0 {
+			for {
+				entries, err := rc.stream.Replay(ctx, last, topics)
+				if err != nil {
+					fmt.Fprintf(w, "event: error\ndata: %q\n\n", "Failed to replay the event log")
+					_ = w.Flush()
+					return
+				}
+				for _, entry := range entries {
+					writeEvent(w, entry)
+					last = entry.ID
+				}
+				if w.Flush() != nil {
+					return
+				}
+				if len(entries) < replayBatch {
+					break
+				}
+			}
+		}
+
+		ticker := time.NewTicker(keepAlivePeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sub.done:
+				return
+			case entry := <-sub.events:
+				if entry.ID <= last {
+					continue
+				}
+				writeEvent(w, entry)
+				last = entry.ID
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+}
+
+// requestedTopics returns the topics of the topics query param, or every topic the principal is allowed to receive
+func requestedTopics(c fiber.Ctx, principal *shared.Principal) []string {
+	if param := c.Query("topics"); param != "" {
+		return strings.Split(param, ",")
+	}
+	return allowedTopics(principal.Permissions)
+}
+
+func writeEvent(w *bufio.Writer, entry EventLog) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", entry.ID, entry.Topic, entry.Payload)
+}
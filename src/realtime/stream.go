@@ -0,0 +1,149 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+const (
+	// keepAlivePeriod is the interval of the comments keeping idle event streams open through the proxies
+	keepAlivePeriod = 15 * time.Second
+	// replayBatch is the number of events read at once when a client resumes
+	replayBatch = 500
+	// retryDelay is the reconnection delay suggested to the clients
+	retryDelay = 3 * time.Second
+)
+
+// Stream persists the catalog events in the event log and relays them to the event stream subscribers
+type Stream struct {
+	repo *EventLogRepository
+
+	// publishing serializes persisting and relaying the events so the subscribers receive them in id order
+	publishing sync.Mutex
+
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	tenantID uint
+	topics   []string
+	events   chan EventLog
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func NewStream(repo *EventLogRepository) *Stream {
+	return &Stream{repo: repo, subscribers: make(map[*subscriber]struct{})}
+}
+
+func (*Stream) ListenerName() string {
+	return "realtime.stream"
+}
+
+// Listen subscribes the stream to every topic relayed to the clients
+func (s *Stream) Listen(bus *shared.EventBus) {
+	for topic := range shared.EventTopics {
+		bus.Subscribe(topic, s)
+	}
+}
+
+// Handle logs the event and relays it to the subscribers, an event delivered again is only relayed once
+func (s *Stream) Handle(event shared.Event) error {
+	tenantEvent, ok := event.(shared.TenantEvent)
+	if !ok {
+		return nil
+	}
+
+	var data any = event
+	if payload, ok := event.(shared.PayloadEvent); ok {
+		data = payload.Payload()
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding event %s for the event log: %v", event.Topic(), err)
+		return nil
+	}
+
+	s.publishing.Lock()
+	defer s.publishing.Unlock()
+
+	entry := EventLog{TenantID: tenantEvent.Tenant(), Topic: event.Topic(), Payload: string(payload)}
+	if identified, ok := event.(shared.IdentifiedEvent); ok {
+		id := identified.EventID()
+		entry.EventID = &id
+	}
+	created, err := s.repo.Create(&entry)
+	if err != nil {
+		return fmt.Errorf("saving event %s in the event log: %w", event.Topic(), err)
+	}
+	if !created {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for sub := range s.subscribers {
+		if sub.tenantID != entry.TenantID || !slices.Contains(sub.topics, entry.Topic) {
+			continue
+		}
+		select {
+		case sub.events <- entry:
+		default:
+			// a subscriber that can't keep up is disconnected, it resumes from the event log on reconnection
+			sub.close()
+		}
+	}
+	return nil
+}
+
+// Replay returns the events of the tenant in the context newer than afterID, oldest first
+func (s *Stream) Replay(ctx context.Context, afterID uint, topics []string) ([]EventLog, error) {
+	return s.repo.FindAfter(ctx, afterID, topics, replayBatch)
+}
+
+// StartPruning deletes every hour the events older than the retention
+func (s *Stream) StartPruning(retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			if _, err := s.repo.Prune(time.Now().Add(-retention)); err != nil {
+				log.Printf("Error pruning the event log: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *Stream) subscribe(tenantID uint, topics []string) *subscriber {
+	sub := &subscriber{
+		tenantID: tenantID,
+		topics:   topics,
+		events:   make(chan EventLog, sendBuffer),
+		done:     make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (s *Stream) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sub)
+	sub.close()
+}
+
+func (sub *subscriber) close() {
+	sub.closeOnce.Do(func() { close(sub.done) })
+}
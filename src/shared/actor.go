@@ -0,0 +1,36 @@
+package shared
+
+import "context"
+
+const ActorSystem = "system"
+
+// Actor is who performed a change, the authenticated principal of a request or the system itself
+type Actor struct {
+	ID        *uint
+	Type      string
+	IP        string
+	UserAgent string
+}
+
+// SystemActor is the actor of changes made outside a request, like seeds and background jobs
+var SystemActor = Actor{Type: ActorSystem}
+
+type actorKey struct{}
+
+// NewActor builds the actor of a request authenticated by the principal
+func NewActor(principal *Principal, ip, userAgent string) Actor {
+	id := principal.ID
+	return Actor{ID: &id, Type: principal.Type, IP: ip, UserAgent: userAgent}
+}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor stored in the context, or the system actor when there is none
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return SystemActor
+}
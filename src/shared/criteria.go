@@ -1,59 +1,408 @@
 package shared
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
 type Operator string
 
 const (
-	OpEq     Operator = "="
-	OpGt     Operator = ">"
-	OpLt     Operator = "<"
-	OpGte    Operator = ">="
-	OpLte    Operator = "<="
-	OpIn     Operator = "IN"
-	OpNot    Operator = "NOT"
-	OpLike   Operator = "LIKE"
+	OpEq    Operator = "="
+	OpGt    Operator = ">"
+	OpLt    Operator = "<"
+	OpGte   Operator = ">="
+	OpLte   Operator = "<="
+	OpIn    Operator = "IN"
+	OpNot   Operator = "NOT"
+	OpLike  Operator = "LIKE"
+	OpILike Operator = "ILIKE"
+	// OpIsNull checks the field IS NULL when the value is true and IS NOT NULL when false
+	OpIsNull Operator = "IS NULL"
+	// OpBetween expects a slice with the lower and upper bounds
+	OpBetween Operator = "BETWEEN"
+	// OpAll and OpNone are the all-of and none-of counterparts of OpIn for membership fields
+	OpAll  Operator = "ALL"
+	OpNone Operator = "NONE"
+	// OpGroup wraps the []Criterion given as value in parentheses, members are joined with their Or flag
+	OpGroup  Operator = "GROUP"
 	OpLimit  Operator = "LIMIT"
 	OpOffset Operator = "OFFSET"
+	// OpSort orders by the field, the value is the direction SortAsc or SortDesc
+	OpSort Operator = "SORT"
+	// OpSeek orders by the field and seeks past the Cursor given as value (keyset pagination),
+	// the field is used as tiebreaker after the OpSort criteria
+	OpSeek Operator = "SEEK"
+)
+
+const (
+	SortAsc  = "ASC"
+	SortDesc = "DESC"
+)
+
+var (
+	ErrUnknownField       = errors.New("unknown field")
+	ErrOperatorNotAllowed = errors.New("operator not allowed")
+	ErrInvalidValue       = errors.New("invalid value")
+	ErrInvalidFilter      = errors.New("invalid filter")
 )
 
+// CriteriaError is returned when a criterion does not match the schema of the model
+type CriteriaError struct {
+	Field    string
+	Operator Operator
+	Err      error
+}
+
+func (e *CriteriaError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%v for %s", e.Err, e.Operator)
+	}
+	if e.Operator == "" {
+		return fmt.Sprintf("%v: %q", e.Err, e.Field)
+	}
+	return fmt.Sprintf("%v: %q %s", e.Err, e.Field, e.Operator)
+}
+
+func (e *CriteriaError) Unwrap() error {
+	return e.Err
+}
+
+// IsCriteriaError reports whether err was caused by invalid criteria sent by the client
+func IsCriteriaError(err error) bool {
+	var criteriaErr *CriteriaError
+	return errors.As(err, &criteriaErr) || errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrInvalidSort)
+}
+
 type Criterion struct {
 	Field    string
 	Operator Operator
 	Value    any
 	Or       bool
+	// Negate wraps the condition in NOT (...)
+	Negate bool
 }
 
-func ApplyCriterion(db *gorm.DB, c Criterion) *gorm.DB {
-	clause := ""
+// ApplyCriterion validates the criterion against the schema and adds it to the query,
+// the field is resolved to its column and always quoted
+func ApplyCriterion(db *gorm.DB, schema *Schema, c Criterion) (*gorm.DB, error) {
+	switch c.Operator {
+	case OpLimit, OpOffset:
+		n, ok := coerceCount(c.Value)
+		if !ok {
+			return nil, &CriteriaError{Operator: c.Operator, Err: ErrInvalidValue}
+		}
+		if c.Operator == OpLimit {
+			return db.Limit(n), nil
+		}
+		return db.Offset(n), nil
+	case OpSeek:
+		return applySeek(db, schema, c, nil)
+	case OpSort:
+		field, err := schema.Field(c.Field)
+		if err != nil {
+			return nil, err
+		}
+		if !field.Allows(c.Operator) {
+			return nil, &CriteriaError{Field: c.Field, Operator: c.Operator, Err: ErrOperatorNotAllowed}
+		}
+		direction, _ := c.Value.(string)
+		return db.Order(clause.OrderByColumn{Column: schema.Column(field), Desc: direction == SortDesc}), nil
+	}
+
+	expr, err := Expression(schema, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Or {
+		return db.Or(expr), nil
+	}
+
+	return db.Where(expr), nil
+}
+
+// Expression builds the SQL condition of a filtering criterion
+func Expression(schema *Schema, c Criterion) (clause.Expression, error) {
+	var expr clause.Expression
+	var err error
+
+	if c.Operator == OpGroup {
+		expr, err = groupExpression(schema, c)
+	} else {
+		expr, err = fieldExpression(schema, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Negate {
+		return clause.Not(expr), nil
+	}
+	return expr, nil
+}
+
+func groupExpression(schema *Schema, c Criterion) (clause.Expression, error) {
+	members, ok := c.Value.([]Criterion)
+	if !ok || len(members) == 0 {
+		return nil, &CriteriaError{Operator: c.Operator, Err: ErrInvalidValue}
+	}
+
+	var group clause.Expression
+	for i, member := range members {
+		expr, err := Expression(schema, member)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0:
+			group = expr
+		case member.Or:
+			group = clause.Or(group, expr)
+		default:
+			group = clause.And(group, expr)
+		}
+	}
+
+	return clause.And(group), nil
+}
+
+func fieldExpression(schema *Schema, c Criterion) (clause.Expression, error) {
+	field, err := schema.Field(c.Field)
+	if err != nil {
+		return nil, err
+	}
+	if !field.Allows(c.Operator) {
+		return nil, &CriteriaError{Field: c.Field, Operator: c.Operator, Err: ErrOperatorNotAllowed}
+	}
+
+	invalid := &CriteriaError{Field: c.Field, Operator: c.Operator, Err: ErrInvalidValue}
+
+	if field.Membership != nil {
+		return membershipExpression(schema, field, c)
+	}
+
+	column := schema.Column(field)
+
 	switch c.Operator {
-	case OpEq, OpGt, OpLt, OpGte, OpLte:
-		clause = c.Field + " " + string(c.Operator) + " ?"
-	case OpLike:
-		clause = c.Field + " LIKE ?"
 	case OpIn:
-		//TODO parser array to string (...values)
-		clause = c.Field + " IN ?"
+		values, ok := coerceSlice(field, c.Value)
+		if !ok {
+			return nil, invalid
+		}
+		return clause.IN{Column: column, Values: values}, nil
+	case OpBetween:
+		bounds, ok := coerceSlice(field, c.Value)
+		if !ok || len(bounds) != 2 {
+			return nil, invalid
+		}
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []any{column, bounds[0], bounds[1]}}, nil
+	case OpIsNull:
+		isNull, ok := FieldBoolType.Coerce(c.Value)
+		if !ok {
+			return nil, invalid
+		}
+		if isNull.(bool) {
+			return clause.Expr{SQL: "? IS NULL", Vars: []any{column}}, nil
+		}
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []any{column}}, nil
+	}
+
+	value, ok := field.Coerce(c.Value)
+	if !ok {
+		return nil, invalid
+	}
+
+	switch c.Operator {
+	case OpEq:
+		return clause.Eq{Column: column, Value: value}, nil
+	case OpGt:
+		return clause.Gt{Column: column, Value: value}, nil
+	case OpLt:
+		return clause.Lt{Column: column, Value: value}, nil
+	case OpGte:
+		return clause.Gte{Column: column, Value: value}, nil
+	case OpLte:
+		return clause.Lte{Column: column, Value: value}, nil
+	case OpLike:
+		return clause.Like{Column: column, Value: value}, nil
+	case OpILike:
+		return clause.Expr{SQL: "? ILIKE ?", Vars: []any{column, value}}, nil
 	case OpNot:
-		clause = "NOT " + c.Field + " = ?"
-	case OpLimit:
-		return db.Limit(c.Value.(int))
-	case OpOffset:
-		return db.Offset(c.Value.(int))
+		return clause.Not(clause.Eq{Column: column, Value: value}), nil
 	}
 
-	if c.Or {
-		return db.Or(clause, c.Value)
+	return nil, &CriteriaError{Field: c.Field, Operator: c.Operator, Err: ErrOperatorNotAllowed}
+}
+
+// membershipExpression filters the rows linked through a join table, e.g. products by category.
+// OpIn keeps the rows linked to any of the values, OpAll to all of them and OpNone to none of them
+func membershipExpression(schema *Schema, field Field, c Criterion) (clause.Expression, error) {
+	m := field.Membership
+
+	values, ok := coerceSlice(field, c.Value)
+	if !ok {
+		return nil, &CriteriaError{Field: c.Field, Operator: c.Operator, Err: ErrInvalidValue}
+	}
+
+	vars := []any{
+		clause.Column{Table: schema.Table, Name: m.LocalKey},
+		clause.Column{Table: m.Table, Name: m.OwnerKey},
+		clause.Table{Name: m.Table},
+		clause.Column{Table: m.Table, Name: m.ForeignKey},
+		values,
+		clause.Column{Table: m.Table, Name: "deleted_at"},
 	}
 
-	return db.Where(clause, c.Value)
+	switch c.Operator {
+	case OpIn:
+		return clause.Expr{SQL: "? IN (SELECT ? FROM ? WHERE ? IN ? AND ? IS NULL)", Vars: vars}, nil
+	case OpNone:
+		return clause.Expr{SQL: "? NOT IN (SELECT ? FROM ? WHERE ? IN ? AND ? IS NULL)", Vars: vars}, nil
+	case OpAll:
+		distinct := make(map[any]bool, len(values))
+		for _, value := range values {
+			distinct[value] = true
+		}
+		vars = append(vars, clause.Column{Table: m.Table, Name: m.OwnerKey}, clause.Column{Table: m.Table, Name: m.ForeignKey}, len(distinct))
+		return clause.Expr{
+			SQL:  "? IN (SELECT ? FROM ? WHERE ? IN ? AND ? IS NULL GROUP BY ? HAVING COUNT(DISTINCT ?) = ?)",
+			Vars: vars,
+		}, nil
+	}
+
+	return nil, &CriteriaError{Field: c.Field, Operator: c.Operator, Err: ErrOperatorNotAllowed}
+}
+
+// coerceCount converts a value of any integer kind to a count, rejecting negative and overflowing values
+func coerceCount(value any) (int, bool) {
+	val := reflect.ValueOf(value)
+	switch {
+	case val.CanInt():
+		n := val.Int()
+		return int(n), n >= 0 && n <= math.MaxInt
+	case val.CanUint():
+		n := val.Uint()
+		return int(n), n <= math.MaxInt
+	}
+	return 0, false
 }
 
-func ApplyCriteria(db *gorm.DB, criteria []Criterion) *gorm.DB {
+func coerceSlice(field Field, value any) ([]any, bool) {
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.Slice || val.Len() == 0 {
+		return nil, false
+	}
+	values := make([]any, 0, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		v, ok := field.Coerce(val.Index(i).Interface())
+		if !ok {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	return values, true
+}
+
+// ApplyCriteria applies the criteria in order, the queries of tenanted schemas are restricted to the tenant
+// of the statement context
+func ApplyCriteria(db *gorm.DB, schema *Schema, criteria []Criterion) (*gorm.DB, error) {
 	query := db
+	if schema.Tenanted {
+		query = query.Scopes(TenantScope(schema.Table))
+	}
 	for _, c := range criteria {
-		query = ApplyCriterion(query, c)
+		var err error
+		if c.Operator == OpSeek {
+			query, err = applySeek(query, schema, c, SortsOf(criteria))
+		} else {
+			query, err = ApplyCriterion(query, schema, c)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
+// SortsOf returns the OpSort criteria in the order they are applied
+func SortsOf(criteria []Criterion) []Criterion {
+	sorts := make([]Criterion, 0)
+	for _, c := range criteria {
+		if c.Operator == OpSort {
+			sorts = append(sorts, c)
+		}
+	}
+	return sorts
+}
+
+// applySeek keeps only the rows after the cursor following the sort order,
+// for sorts (a ASC, b DESC) it produces:
+// (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id > ?)
+func applySeek(db *gorm.DB, schema *Schema, c Criterion, sorts []Criterion) (*gorm.DB, error) {
+	tiebreaker, err := schema.Field(c.Field)
+	if err != nil {
+		return nil, err
+	}
+	if !tiebreaker.Allows(OpSeek) {
+		return nil, &CriteriaError{Field: c.Field, Operator: c.Operator, Err: ErrOperatorNotAllowed}
+	}
+
+	query := db.Order(clause.OrderByColumn{Column: schema.Column(tiebreaker)})
+	cursor, ok := c.Value.(Cursor)
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.IsZero() {
+		return query, nil
+	}
+	if len(cursor.Values) != len(sorts) {
+		return nil, ErrInvalidCursor
+	}
+
+	columns := make([]clause.Column, len(sorts))
+	values := make([]any, len(sorts))
+	for i, sort := range sorts {
+		field, err := schema.Field(sort.Field)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := field.Coerce(cursor.Values[i])
+		if !ok {
+			return nil, ErrInvalidCursor
+		}
+		columns[i] = schema.Column(field)
+		values[i] = value
+	}
+
+	branches := make([]string, 0, len(sorts)+1)
+	args := make([]any, 0)
+	for i := 0; i <= len(sorts); i++ {
+		conditions := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, "? = ?")
+			args = append(args, columns[j], values[j])
+		}
+		if i < len(sorts) {
+			operator := "? > ?"
+			if direction, _ := sorts[i].Value.(string); direction == SortDesc {
+				operator = "? < ?"
+			}
+			conditions = append(conditions, operator)
+			args = append(args, columns[i], values[i])
+		} else {
+			conditions = append(conditions, "? > ?")
+			args = append(args, schema.Column(tiebreaker), cursor.ID)
+		}
+		branches = append(branches, "("+strings.Join(conditions, " AND ")+")")
 	}
 
-	return query
+	return query.Where(clause.Expr{SQL: "(" + strings.Join(branches, " OR ") + ")", Vars: args}), nil
 }
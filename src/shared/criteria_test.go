@@ -0,0 +1,213 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var itemSchema = &Schema{
+	Table: "items",
+	Fields: map[string]Field{
+		"name": {
+			Column:    "name",
+			Type:      FieldString,
+			Operators: []Operator{OpEq, OpLike},
+		},
+		"price": {
+			Column:    "price",
+			Type:      FieldNumber,
+			Operators: []Operator{OpGt, OpLt},
+			Sortable:  true,
+		},
+		"categories": {
+			Type:      FieldInteger,
+			Operators: []Operator{OpIn},
+			Membership: &Membership{
+				Table:      "item_categories",
+				LocalKey:   "id",
+				OwnerKey:   "item_id",
+				ForeignKey: "category_id",
+			},
+		},
+	},
+}
+
+// dryRun returns a session building the SQL without running it
+func dryRun(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db.Table("items")
+}
+
+func TestApplyCriterionRejectsHostileFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		criterion Criterion
+	}{
+		{"filter with statement", Criterion{Field: "name; DROP TABLE items", Operator: OpEq, Value: "x"}},
+		{"filter with quoted identifier", Criterion{Field: `"name"`, Operator: OpEq, Value: "x"}},
+		{"filter with qualified name", Criterion{Field: "a.b", Operator: OpEq, Value: "x"}},
+		{"filter with comment", Criterion{Field: "name /* */", Operator: OpLike, Value: "%x%"}},
+		{"sort with statement", Criterion{Field: "price; DROP", Operator: OpSort, Value: SortAsc}},
+		{"sort with quoted identifier", Criterion{Field: `"items"."price"`, Operator: OpSort, Value: SortDesc}},
+		{"seek with qualified name", Criterion{Field: "items.id", Operator: OpSeek, Value: Cursor{}}},
+		{"group member", Criterion{Operator: OpGroup, Value: []Criterion{{Field: "a.b", Operator: OpEq, Value: "x"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyCriterion(dryRun(t), itemSchema, tt.criterion)
+			if !errors.Is(err, ErrUnknownField) {
+				t.Fatalf("error = %v, want ErrUnknownField", err)
+			}
+		})
+	}
+}
+
+func TestApplyCriterionRejectsOperatorsNotAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		criterion Criterion
+	}{
+		{"operator of another field", Criterion{Field: "name", Operator: OpGt, Value: "x"}},
+		{"unknown operator", Criterion{Field: "name", Operator: Operator("= 1 OR 1 ="), Value: "x"}},
+		{"statement as operator", Criterion{Field: "price", Operator: Operator("; DROP TABLE items; --"), Value: "1"}},
+		{"lowercase operator", Criterion{Field: "price", Operator: Operator("gt"), Value: "1"}},
+		{"membership operator on a column", Criterion{Field: "name", Operator: OpAll, Value: []string{"x"}}},
+		{"column operator on a membership", Criterion{Field: "categories", Operator: OpEq, Value: "1"}},
+		{"sort on a field not sortable", Criterion{Field: "name", Operator: OpSort, Value: SortAsc}},
+		{"seek on a field not sortable", Criterion{Field: "name", Operator: OpSeek, Value: Cursor{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyCriterion(dryRun(t), itemSchema, tt.criterion)
+			if !errors.Is(err, ErrOperatorNotAllowed) || !IsCriteriaError(err) {
+				t.Fatalf("error = %v, want ErrOperatorNotAllowed", err)
+			}
+		})
+	}
+}
+
+func TestApplyCriterionRejectsInvalidPagination(t *testing.T) {
+	values := []any{"10", "10; DROP TABLE items", 10.5, float64(10), -1, int64(-1), uint64(math.MaxUint64), nil, []int{1}}
+	for _, operator := range []Operator{OpLimit, OpOffset} {
+		for _, value := range values {
+			t.Run(fmt.Sprintf("%s %T(%v)", operator, value, value), func(t *testing.T) {
+				_, err := ApplyCriterion(dryRun(t), itemSchema, Criterion{Operator: operator, Value: value})
+				var criteriaErr *CriteriaError
+				if !errors.As(err, &criteriaErr) || !errors.Is(err, ErrInvalidValue) || criteriaErr.Operator != operator {
+					t.Fatalf("%s %#v error = %v, want a CriteriaError with ErrInvalidValue", operator, value, err)
+				}
+			})
+		}
+	}
+}
+
+func TestApplyCriterionAcceptsIntegerPagination(t *testing.T) {
+	values := []any{10, int8(10), int32(10), int64(10), uint(10), uint16(10), uint64(10)}
+	for _, operator := range []Operator{OpLimit, OpOffset} {
+		for _, value := range values {
+			t.Run(fmt.Sprintf("%s %T", operator, value), func(t *testing.T) {
+				query, err := ApplyCriterion(dryRun(t), itemSchema, Criterion{Operator: operator, Value: value})
+				if err != nil {
+					t.Fatal(err)
+				}
+				statement := query.Find(&[]map[string]any{}).Statement
+				if len(statement.Vars) != 1 || statement.Vars[0] != 10 {
+					t.Fatalf("vars = %#v, want the int 10", statement.Vars)
+				}
+			})
+		}
+	}
+}
+
+func TestApplyCriteriaQuotesIdentifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		criteria []Criterion
+		sql      string
+		vars     []any
+	}{
+		{
+			name:     "equality",
+			criteria: []Criterion{{Field: "name", Operator: OpEq, Value: "x' OR '1'='1"}},
+			sql:      `SELECT * FROM "items" WHERE "items"."name" = $1`,
+			vars:     []any{"x' OR '1'='1"},
+		},
+		{
+			name:     "like",
+			criteria: []Criterion{{Field: "name", Operator: OpLike, Value: "%; DROP TABLE items%"}},
+			sql:      `SELECT * FROM "items" WHERE "items"."name" LIKE $1`,
+			vars:     []any{"%; DROP TABLE items%"},
+		},
+		{
+			name:     "sort",
+			criteria: []Criterion{{Field: "price", Operator: OpSort, Value: SortDesc}},
+			sql:      `SELECT * FROM "items" ORDER BY "items"."price" DESC`,
+		},
+		{
+			name:     "membership",
+			criteria: []Criterion{{Field: "categories", Operator: OpIn, Value: []string{"1", "2"}}},
+			sql: `SELECT * FROM "items" WHERE "items"."id" IN (SELECT "item_categories"."item_id" FROM "item_categories" ` +
+				`WHERE "item_categories"."category_id" IN ($1,$2) AND "item_categories"."deleted_at" IS NULL)`,
+			vars: []any{int64(1), int64(2)},
+		},
+		{
+			name:     "pagination",
+			criteria: []Criterion{{Operator: OpLimit, Value: 5}, {Operator: OpOffset, Value: 10}},
+			sql:      `SELECT * FROM "items" LIMIT $1 OFFSET $2`,
+			vars:     []any{5, 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ApplyCriteria(dryRun(t), itemSchema, tt.criteria)
+			if err != nil {
+				t.Fatal(err)
+			}
+			statement := query.Find(&[]map[string]any{}).Statement
+			if sql := statement.SQL.String(); sql != tt.sql {
+				t.Fatalf("SQL = %s\nwant  %s", sql, tt.sql)
+			}
+			if len(statement.Vars) != len(tt.vars) {
+				t.Fatalf("vars = %v, want %v", statement.Vars, tt.vars)
+			}
+			for i, v := range tt.vars {
+				if statement.Vars[i] != v {
+					t.Fatalf("var %d = %#v, want %#v", i, statement.Vars[i], v)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFiltersRejectsHostileKeys(t *testing.T) {
+	keys := []string{
+		"filter[name; DROP TABLE items][eq]",
+		`filter["name"][eq]`,
+		"filter[a.b][eq]",
+		"filter[not][items.name][eq]",
+		"filter[or][g][name) OR (1=1][eq]",
+	}
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			_, err := ParseFilters(map[string]string{key: "x"}, itemSchema)
+			if !errors.Is(err, ErrUnknownField) {
+				t.Fatalf("error = %v, want ErrUnknownField", err)
+			}
+		})
+	}
+
+	_, err := ParseFilters(map[string]string{"filter[name][eq;DROP]": "x"}, itemSchema)
+	if !errors.Is(err, ErrOperatorNotAllowed) || !strings.Contains(err.Error(), "eq;DROP") {
+		t.Fatalf("error = %v, want ErrOperatorNotAllowed", err)
+	}
+}
@@ -0,0 +1,110 @@
+package shared
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of the last seen row of a keyset paginated listing,
+// it is sent to clients as an opaque string
+type Cursor struct {
+	Values []any `json:"v,omitempty"`
+	ID     uint  `json:"id"`
+}
+
+func (c Cursor) IsZero() bool {
+	return c.ID == 0 && len(c.Values) == 0
+}
+
+func EncodeCursor(c Cursor) string {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	for i, value := range c.Values {
+		if number, ok := value.(json.Number); ok {
+			if n, err := number.Int64(); err == nil {
+				c.Values[i] = n
+			} else if f, err := number.Float64(); err == nil {
+				c.Values[i] = f
+			}
+		}
+	}
+	return c, nil
+}
+
+// NextCursor returns the cursor pointing after the last item of a full page,
+// or an empty string when there are no more rows to read.
+// The cursor holds the ID and the values of the sorted columns of the item
+func NextCursor(last any, criteria []Criterion, count, limit int) string {
+	if count == 0 || count < limit {
+		return ""
+	}
+
+	val := reflect.Indirect(reflect.ValueOf(last))
+	if val.Kind() != reflect.Struct {
+		return ""
+	}
+
+	cursor := Cursor{}
+	if id := val.FieldByName("ID"); id.IsValid() && id.CanUint() {
+		cursor.ID = uint(id.Uint())
+	}
+
+	for _, sort := range SortsOf(criteria) {
+		field, ok := fieldByColumn(val, sort.Field)
+		if !ok {
+			return ""
+		}
+		cursor.Values = append(cursor.Values, cursorValue(field.Interface()))
+	}
+
+	return EncodeCursor(cursor)
+}
+
+func fieldByColumn(val reflect.Value, column string) (reflect.Value, bool) {
+	naming := schema.NamingStrategy{}
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		if naming.ColumnName("", typ.Field(i).Name) == column {
+			return val.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// cursorValue converts a column value into a JSON friendly value the database can compare against
+func cursorValue(value any) any {
+	if valuer, ok := value.(driver.Valuer); ok {
+		if v, err := valuer.Value(); err == nil {
+			value = v
+		}
+	}
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return value
+}
@@ -1,23 +1,147 @@
 package shared
 
-import "sync"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrEventWithoutID = errors.New("event without ID")
 
 type Event interface {
 	Topic() string
 }
 
+// TenantEvent is implemented by the events about rows owned by a tenant
+type TenantEvent interface {
+	Event
+	Tenant() uint
+}
+
+// PayloadEvent exposes the data of an event to external consumers, like the realtime feed
+type PayloadEvent interface {
+	Event
+	Payload() any
+}
+
+// IdentifiedEvent is implemented by the events embedding EventMeta
+type IdentifiedEvent interface {
+	Event
+	EventID() uuid.UUID
+	EventTime() time.Time
+}
+
+// EventMeta identifies an occurrence of an event. The ID is the idempotency key the listeners discard
+// the redeliveries of an event with
+type EventMeta struct {
+	ID         uuid.UUID
+	OccurredAt time.Time
+}
+
+func NewEventMeta() EventMeta {
+	return EventMeta{ID: uuid.New(), OccurredAt: time.Now()}
+}
+
+func (m EventMeta) EventID() uuid.UUID {
+	return m.ID
+}
+
+func (m EventMeta) EventTime() time.Time {
+	return m.OccurredAt
+}
+
+// EventTopics are the catalog topics delivered to external consumers, like the realtime feeds and the webhooks,
+// and the permission required to receive them
+var EventTopics = map[string]Permission{
+	"product.created":            PermProductsRead,
+	"product.updated":            PermProductsRead,
+	"product.deleted":            PermProductsRead,
+	"product.restored":           PermProductsRead,
+	"product.purged":             PermProductsRead,
+	"product.categories_updated": PermProductsRead,
+	"category.created":           PermCategoriesRead,
+	"category.updated":           PermCategoriesRead,
+	"category.deleted":           PermCategoriesRead,
+	"category.restored":          PermCategoriesRead,
+	"category.purged":            PermCategoriesRead,
+}
+
+// eventTypes are the registered event types by topic
+var eventTypes = make(map[string]reflect.Type)
+
+// RegisterEvents records the type of the events by their topic so they can be decoded from JSON,
+// it is meant to be called from the init of the packages declaring the events
+func RegisterEvents(events ...Event) {
+	for _, event := range events {
+		eventTypes[event.Topic()] = reflect.TypeOf(event)
+	}
+}
+
+// DecodeEvent decodes the JSON of an event of a registered topic
+func DecodeEvent(topic string, data []byte) (Event, error) {
+	eventType, found := eventTypes[topic]
+	if !found {
+		return nil, fmt.Errorf("unknown event topic %q", topic)
+	}
+	event := reflect.New(eventType)
+	if err := json.Unmarshal(data, event.Interface()); err != nil {
+		return nil, fmt.Errorf("decoding %s event: %w", topic, err)
+	}
+	return event.Elem().Interface().(Event), nil
+}
+
+// Listener handles the events once the change that raised them is committed. An error asks for the event
+// to be delivered again to the failing listener only. A crash between handling an event and recording it
+// delivered hands it again too, so the listeners must discard the events they already handled by their ID
 type Listener interface {
-	Handle(event Event)
+	Handle(event Event) error
+}
+
+// NamedListener names a listener, the deliveries of an event are recorded per listener under that name.
+// The other listeners are named after their type
+type NamedListener interface {
+	Listener
+	ListenerName() string
+}
+
+// ListenerName returns the name the deliveries to the listener are recorded under
+func ListenerName(listener Listener) string {
+	if named, ok := listener.(NamedListener); ok {
+		return named.ListenerName()
+	}
+	return fmt.Sprintf("%T", listener)
+}
+
+// TxListener handles the events within the transaction of the change that raised them,
+// an error rolls the whole change back
+type TxListener interface {
+	HandleTx(ctx context.Context, event Event) error
+}
+
+// EventStore persists the events published within a unit of work along with the change,
+// and delivers them to the listeners once committed
+type EventStore interface {
+	Append(ctx context.Context, event Event) error
 }
 
 type EventBus struct {
-	listeners map[string][]Listener
-	mu        sync.Mutex
+	listeners   map[string][]Listener
+	txListeners map[string][]TxListener
+	store       EventStore
+	mu          sync.Mutex
 }
 
 func NewEventBus() *EventBus {
 	return &EventBus{
-		listeners: make(map[string][]Listener),
+		listeners:   make(map[string][]Listener),
+		txListeners: make(map[string][]TxListener),
 	}
 }
 
@@ -27,12 +151,84 @@ func (bus *EventBus) Subscribe(topic string, listener Listener) {
 	bus.listeners[topic] = append(bus.listeners[topic], listener)
 }
 
+func (bus *EventBus) SubscribeTx(topic string, listener TxListener) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.txListeners[topic] = append(bus.txListeners[topic], listener)
+}
+
+// UseStore makes PublishTx persist the events in the store instead of publishing them in process
+func (bus *EventBus) UseStore(store EventStore) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.store = store
+}
+
+// Publish hands the event to the listeners in the background, their failures are only logged
 func (bus *EventBus) Publish(event Event) {
 	bus.mu.Lock()
 	defer bus.mu.Unlock()
 	if listeners, found := bus.listeners[event.Topic()]; found {
 		for _, listener := range listeners {
-			go listener.Handle(event)
+			go func() {
+				if err := listener.Handle(event); err != nil {
+					log.Printf("Error handling event %s: %v", event.Topic(), err)
+				}
+			}()
+		}
+	}
+}
+
+// PublishTx runs the transactional listeners of the event with the context, so they write in the unit of work
+// it carries. The event is then appended to the store in the same unit of work, or without a store published
+// to the other listeners once the unit of work commits
+func (bus *EventBus) PublishTx(ctx context.Context, event Event) error {
+	bus.mu.Lock()
+	listeners := append([]TxListener(nil), bus.txListeners[event.Topic()]...)
+	store := bus.store
+	bus.mu.Unlock()
+
+	for _, listener := range listeners {
+		if err := listener.HandleTx(ctx, event); err != nil {
+			return err
 		}
 	}
+	if store != nil {
+		return store.Append(ctx, event)
+	}
+	AfterCommit(ctx, func() { bus.Publish(event) })
+	return nil
+}
+
+// Deliver hands the event to every listener not delivered yet, by name, and waits for them. It returns the names
+// of the listeners that handled it and reports the failures of the others
+func (bus *EventBus) Deliver(event Event, delivered map[string]bool) ([]string, error) {
+	bus.mu.Lock()
+	listeners := append([]Listener(nil), bus.listeners[event.Topic()]...)
+	bus.mu.Unlock()
+
+	var handled []string
+	var errs []error
+	for _, listener := range listeners {
+		name := ListenerName(listener)
+		if delivered[name] {
+			continue
+		}
+		if err := handleSafely(listener, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		handled = append(handled, name)
+	}
+	return handled, errors.Join(errs...)
+}
+
+// handleSafely turns the panic of a listener into an error
+func handleSafely(listener Listener, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("listener %T panicked: %v", listener, r)
+		}
+	}()
+	return listener.Handle(event)
 }
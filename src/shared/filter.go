@@ -0,0 +1,156 @@
+package shared
+
+import (
+	"sort"
+	"strings"
+)
+
+// filterOperators maps the operators of the filter query language to criteria operators
+var filterOperators = map[string]Operator{
+	"eq":      OpEq,
+	"ne":      OpNot,
+	"gt":      OpGt,
+	"gte":     OpGte,
+	"lt":      OpLt,
+	"lte":     OpLte,
+	"in":      OpIn,
+	"like":    OpLike,
+	"ilike":   OpILike,
+	"null":    OpIsNull,
+	"between": OpBetween,
+	"all":     OpAll,
+	"none":    OpNone,
+}
+
+// ParseFilters translates query params using the filter query language into criteria
+// validated against the schema, other params are ignored. Supported forms:
+//
+//	filter[field][op]=value
+//	filter[not][field][op]=value        negates the condition
+//	filter[or][group][field][op]=value  conditions sharing a group are joined with OR
+//
+// in, all, none and between take comma separated values, like and ilike match anywhere
+// unless the value already has a % wildcard and null takes true or false
+func ParseFilters(params map[string]string, schema *Schema) ([]Criterion, error) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	criteria := make([]Criterion, 0, len(keys))
+	groups := make(map[string][]Criterion)
+	groupNames := make([]string, 0)
+
+	for _, key := range keys {
+		segments, ok := filterSegments(key)
+		if !ok {
+			return nil, &CriteriaError{Field: key, Err: ErrInvalidFilter}
+		}
+
+		group := ""
+		if segments[0] == "or" {
+			if len(segments) < 4 {
+				return nil, &CriteriaError{Field: key, Err: ErrInvalidFilter}
+			}
+			group = segments[1]
+			segments = segments[2:]
+		}
+
+		criterion, err := parseFilter(key, segments, params[key], schema)
+		if err != nil {
+			return nil, err
+		}
+
+		if group == "" {
+			criteria = append(criteria, criterion)
+			continue
+		}
+		if _, found := groups[group]; !found {
+			groupNames = append(groupNames, group)
+		} else {
+			criterion.Or = true
+		}
+		groups[group] = append(groups[group], criterion)
+	}
+
+	for _, name := range groupNames {
+		criteria = append(criteria, Criterion{
+			Operator: OpGroup,
+			Value:    groups[name],
+		})
+	}
+
+	return criteria, nil
+}
+
+// filterSegments splits filter[a][b][c] into [a b c]
+func filterSegments(key string) ([]string, bool) {
+	inner := strings.TrimPrefix(key, "filter")
+	if !strings.HasPrefix(inner, "[") || !strings.HasSuffix(inner, "]") {
+		return nil, false
+	}
+	segments := strings.Split(inner[1:len(inner)-1], "][")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, false
+		}
+	}
+	return segments, len(segments) >= 2
+}
+
+func parseFilter(key string, segments []string, value string, schema *Schema) (Criterion, error) {
+	negate := false
+	if segments[0] == "not" {
+		negate = true
+		segments = segments[1:]
+	}
+	if len(segments) != 2 {
+		return Criterion{}, &CriteriaError{Field: key, Err: ErrInvalidFilter}
+	}
+
+	name, opName := segments[0], segments[1]
+	operator, ok := filterOperators[opName]
+	if !ok {
+		return Criterion{}, &CriteriaError{Field: name, Operator: Operator(opName), Err: ErrOperatorNotAllowed}
+	}
+
+	field, err := schema.Field(name)
+	if err != nil {
+		return Criterion{}, err
+	}
+	if !field.Allows(operator) {
+		return Criterion{}, &CriteriaError{Field: name, Operator: operator, Err: ErrOperatorNotAllowed}
+	}
+
+	criterion := Criterion{
+		Field:    name,
+		Operator: operator,
+		Value:    value,
+		Negate:   negate,
+	}
+
+	switch operator {
+	case OpIn, OpBetween, OpAll, OpNone:
+		criterion.Value = splitValues(value)
+	case OpLike, OpILike:
+		if !strings.Contains(value, "%") {
+			criterion.Value = "%" + value + "%"
+		}
+	}
+
+	return criterion, nil
+}
+
+func splitValues(value string) []string {
+	parts := strings.Split(value, ",")
+	values := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
@@ -0,0 +1,331 @@
+package shared
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HistoryTag is the struct tag driving the history of a model: `history:"-"` leaves a field out and
+// `history:"name"` records it under another name. Untagged exported fields are recorded with their name
+const HistoryTag = "history"
+
+const (
+	HistoryNull    = "null"
+	HistoryString  = "string"
+	HistoryInteger = "integer"
+	HistoryNumber  = "number"
+	HistoryDecimal = "decimal"
+	HistoryBoolean = "boolean"
+	HistoryTime    = "time"
+	HistoryObject  = "object"
+	HistoryArray   = "array"
+)
+
+// HistoryValue is a value recorded in a history with its type, stored as JSONB. Decimals are kept as
+// strings so no precision is lost and times as RFC 3339
+type HistoryValue struct {
+	Type string `json:"type"`
+	Data any    `json:"value"`
+}
+
+func (v HistoryValue) Value() (driver.Value, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (v *HistoryValue) Scan(value any) error {
+	switch raw := value.(type) {
+	case []byte:
+		return json.Unmarshal(raw, v)
+	case string:
+		return json.Unmarshal([]byte(raw), v)
+	case nil:
+		*v = HistoryValue{Type: HistoryNull}
+		return nil
+	}
+	return errors.New("unsupported history value")
+}
+
+func (HistoryValue) GormDataType() string {
+	return "jsonb"
+}
+
+// Equal compares the values by their JSON representation
+func (v *HistoryValue) Equal(other *HistoryValue) bool {
+	if v == nil || other == nil {
+		return v == other
+	}
+	a, errA := json.Marshal(v)
+	b, errB := json.Marshal(other)
+	return errA == nil && errB == nil && string(a) == string(b)
+}
+
+// NewHistoryValue types a Go value for the history
+func NewHistoryValue(value any) *HistoryValue {
+	return historyValueOf(reflect.ValueOf(value))
+}
+
+func historyValueOf(value reflect.Value) *HistoryValue {
+	if !value.IsValid() {
+		return &HistoryValue{Type: HistoryNull}
+	}
+	if value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return &HistoryValue{Type: HistoryNull}
+		}
+		return historyValueOf(value.Elem())
+	}
+
+	switch v := value.Interface().(type) {
+	case decimal.Decimal:
+		return &HistoryValue{Type: HistoryDecimal, Data: v.String()}
+	case time.Time:
+		return &HistoryValue{Type: HistoryTime, Data: v.UTC().Format(time.RFC3339Nano)}
+	case gorm.DeletedAt:
+		if !v.Valid {
+			return &HistoryValue{Type: HistoryNull}
+		}
+		return &HistoryValue{Type: HistoryTime, Data: v.Time.UTC().Format(time.RFC3339Nano)}
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return &HistoryValue{Type: HistoryString, Data: value.String()}
+	case reflect.Bool:
+		return &HistoryValue{Type: HistoryBoolean, Data: value.Bool()}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &HistoryValue{Type: HistoryInteger, Data: value.Int()}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &HistoryValue{Type: HistoryInteger, Data: value.Uint()}
+	case reflect.Float32, reflect.Float64:
+		return &HistoryValue{Type: HistoryNumber, Data: value.Float()}
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return &HistoryValue{Type: HistoryNull}
+		}
+		return &HistoryValue{Type: HistoryArray, Data: value.Interface()}
+	}
+	return &HistoryValue{Type: HistoryObject, Data: value.Interface()}
+}
+
+// FieldChange is the change of a field between two versions of a model, OldValue is nil on creation
+type FieldChange struct {
+	Field    string
+	OldValue *HistoryValue
+	NewValue *HistoryValue
+}
+
+const (
+	// HistoryFieldDeletedAt is the field recording the moves of a model to the trash and back, it is null
+	// while the model is in use
+	HistoryFieldDeletedAt = "DeletedAt"
+	// HistoryFieldPurgedAt is the field recording the purge of a model, the last entry of its history
+	HistoryFieldPurgedAt = "PurgedAt"
+)
+
+// DeletionChange is the change of a model moved to the trash at the given time
+func DeletionChange(at time.Time) FieldChange {
+	return FieldChange{Field: HistoryFieldDeletedAt, OldValue: NewHistoryValue(nil), NewValue: NewHistoryValue(at)}
+}
+
+// RestorationChange is the change of a model taken out of the trash it was moved to at deletedAt
+func RestorationChange(deletedAt time.Time) FieldChange {
+	return FieldChange{Field: HistoryFieldDeletedAt, OldValue: NewHistoryValue(deletedAt), NewValue: NewHistoryValue(nil)}
+}
+
+// PurgeChange is the change of a model permanently removed at the given time
+func PurgeChange(at time.Time) FieldChange {
+	return FieldChange{Field: HistoryFieldPurgedAt, OldValue: NewHistoryValue(nil), NewValue: NewHistoryValue(at)}
+}
+
+// DiffFields compares two versions of a struct field by field following the history tags of the struct.
+// A nil before lists every field as created
+func DiffFields(before, after any) []FieldChange {
+	newVal := reflect.ValueOf(after)
+	typeOf := newVal.Type()
+
+	var oldVal reflect.Value
+	if before != nil {
+		oldVal = reflect.ValueOf(before)
+	}
+
+	changes := make([]FieldChange, 0)
+	for i := 0; i < typeOf.NumField(); i++ {
+		field := typeOf.Field(i)
+		name, tracked := historyField(field)
+		if !tracked {
+			continue
+		}
+
+		newValue := historyValueOf(newVal.Field(i))
+		if !oldVal.IsValid() {
+			changes = append(changes, FieldChange{Field: name, NewValue: newValue})
+			continue
+		}
+
+		oldValue := historyValueOf(oldVal.Field(i))
+		if !oldValue.Equal(newValue) {
+			changes = append(changes, FieldChange{Field: name, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+	return changes
+}
+
+// historyField returns the name a struct field is recorded with, and false when it is left out of the history
+func historyField(field reflect.StructField) (string, bool) {
+	if !field.IsExported() || field.Anonymous {
+		return "", false
+	}
+	tag := field.Tag.Get(HistoryTag)
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	}
+	return tag, true
+}
+
+// HistoryEntry is a history entry of a model, with an event_id column unique to the event it records
+type HistoryEntry interface {
+	HistoryID() uint
+}
+
+// HistoryDetail is a detail of a history entry, attached to the entry once it is created
+type HistoryDetail interface {
+	SetHistoryID(id uint)
+}
+
+// RecordHistory creates the history entry along with its details, in the order they were given, in the unit
+// of work of the context. An entry whose event is recorded already is skipped, so handling it again is harmless
+func RecordHistory[D any, PD interface {
+	*D
+	HistoryDetail
+}](ctx context.Context, db *gorm.DB, history HistoryEntry, details []D) error {
+	db = DB(ctx, db)
+	result := db.Omit("Details").
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).
+		Create(history)
+	if result.Error != nil {
+		return fmt.Errorf("creating %s: %w", result.Statement.Table, result.Error)
+	}
+	if result.RowsAffected == 0 || len(details) == 0 {
+		return nil
+	}
+
+	for i := range details {
+		PD(&details[i]).SetHistoryID(history.HistoryID())
+	}
+	result = db.Create(&details)
+	if result.Error != nil {
+		return fmt.Errorf("creating %s: %w", result.Statement.Table, result.Error)
+	}
+	return nil
+}
+
+// PatchOperation is a JSON Patch (RFC 6902) operation
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// NewPatchOperation builds an operation on the path made of the given JSON Pointer (RFC 6901) tokens,
+// a nil value is left out as required by the remove operation
+func NewPatchOperation(op string, value *HistoryValue, tokens ...string) (PatchOperation, error) {
+	escaped := make([]string, len(tokens))
+	for i, token := range tokens {
+		escaped[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+	}
+
+	operation := PatchOperation{Op: op, Path: "/" + strings.Join(escaped, "/")}
+	if value != nil {
+		raw, err := json.Marshal(value.Data)
+		if err != nil {
+			return operation, fmt.Errorf("encoding %s: %w", operation.Path, err)
+		}
+		operation.Value = raw
+	}
+	return operation, nil
+}
+
+// MigrateHistoryValues converts the old_value and new_value text columns of the history detail tables
+// to typed JSONB values. The previous values were formatted strings, so they are kept as strings
+func MigrateHistoryValues(db *gorm.DB, tables ...string) error {
+	for _, table := range tables {
+		for _, column := range []string{"old_value", "new_value"} {
+			var dataType string
+			err := db.Raw(`SELECT data_type FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`, table, column).
+				Scan(&dataType).Error
+			if err != nil {
+				return err
+			}
+			if dataType != "text" {
+				continue
+			}
+
+			err = db.Exec(fmt.Sprintf(`ALTER TABLE %[1]s ALTER COLUMN %[2]s TYPE jsonb USING
+				CASE WHEN %[2]s IS NULL THEN NULL ELSE jsonb_build_object('type', 'string', 'value', %[2]s) END`, table, column)).Error
+			if err != nil {
+				return fmt.Errorf("migrating %s.%s: %w", table, column, err)
+			}
+		}
+	}
+	return nil
+}
+
+// legacyTimeLayout is the format of the times recorded before the history values were typed
+const legacyTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// AssignTo sets the value on the variable target points to. The strings recorded before the values
+// were typed are parsed, so "12.50" can still be assigned to a decimal or "3" to an int
+func (v *HistoryValue) AssignTo(target any) error {
+	if v == nil || v.Type == HistoryNull {
+		reflect.ValueOf(target).Elem().SetZero()
+		return nil
+	}
+
+	raw, err := json.Marshal(v.Data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, target); err == nil {
+		return nil
+	}
+
+	if s, ok := v.Data.(string); ok {
+		if err := json.Unmarshal([]byte(s), target); err == nil {
+			return nil
+		}
+		if t, ok := target.(*time.Time); ok {
+			if parsed, err := time.Parse(legacyTimeLayout, s); err == nil {
+				*t = parsed
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("can't assign %s value %v to %T", v.Type, v.Data, target)
+}
+
+// AssignField sets the value on the field of the struct recorded under the given history name,
+// it reports false when the struct has no such field
+func AssignField(target any, name string, value *HistoryValue) (bool, error) {
+	structVal := reflect.ValueOf(target).Elem()
+	for i := 0; i < structVal.NumField(); i++ {
+		if fieldName, tracked := historyField(structVal.Type().Field(i)); tracked && fieldName == name {
+			return true, value.AssignTo(structVal.Field(i).Addr().Interface())
+		}
+	}
+	return false, nil
+}
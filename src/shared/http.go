@@ -1,6 +1,10 @@
 package shared
 
 import (
+	"net/url"
+	"strconv"
+	"strings"
+
 	"github.com/gofiber/fiber/v3"
 )
 
@@ -12,10 +16,26 @@ type Response struct {
 
 type PaginatedResponse struct {
 	Response
-	Page  int `json:"page,omitempty"`
-	Limit int `json:"limit,omitempty"`
-	//TotalItems int64 `json:"totalItems,omitempty"`
-	//TotalPages int   `json:"totalPages,omitempty"`
+	Page       int         `json:"page,omitempty"`
+	Limit      int         `json:"limit,omitempty"`
+	TotalItems int64       `json:"totalItems"`
+	TotalPages int         `json:"totalPages"`
+	Next       string      `json:"next,omitempty"`
+	Prev       string      `json:"prev,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Facets     interface{} `json:"facets,omitempty"`
+}
+
+// PageInfo describes the page being sent in a PaginatedResponse
+type PageInfo struct {
+	Page       int
+	Limit      int
+	TotalItems int64
+	// Cursor is the cursor used to request the page, empty on offset pagination
+	Cursor     string
+	NextCursor string
+	// Facets are optional aggregations of the whole listing sent along the page
+	Facets interface{}
 }
 
 func NewSuccessResponse(c fiber.Ctx, status int, data interface{}) error {
@@ -46,15 +66,102 @@ func NewValidationErrorResponse(c fiber.Ctx, errors []ErrorResponse) error {
 	})
 }
 
-func NewPaginatedResponse(c fiber.Ctx, status int, data interface{}, page, limit int) error {
-	return c.Status(status).JSON(PaginatedResponse{
+// NewPaginatedResponse writes the page of data along with its metadata,
+// links to the adjacent pages are also sent through the Link header
+func NewPaginatedResponse(c fiber.Ctx, status int, data interface{}, info PageInfo) error {
+	page, limit := NormalizePagination(info.Page, info.Limit)
+	totalPages := TotalPages(info.TotalItems, limit)
+
+	response := PaginatedResponse{
 		Response: Response{
 			Success: true,
 			Data:    data,
 		},
-		Page:  page,
-		Limit: limit,
-		//TotalItems: totalItems,
-		//TotalPages: totalPages,
+		Limit:      limit,
+		TotalItems: info.TotalItems,
+		TotalPages: totalPages,
+		NextCursor: info.NextCursor,
+		Facets:     info.Facets,
+	}
+
+	links := make([]string, 0, 4)
+	if info.Cursor != "" {
+		// pages have no number when walking the rows with a cursor
+		if info.NextCursor != "" {
+			response.Next = cursorURL(c, info.NextCursor, limit)
+			links = append(links, `<`+response.Next+`>; rel="next"`)
+		}
+	} else {
+		response.Page = page
+		if page < totalPages {
+			response.Next = pageURL(c, page+1, limit)
+			links = append(links, `<`+response.Next+`>; rel="next"`)
+		}
+		if page > 1 && totalPages > 0 {
+			response.Prev = pageURL(c, min(page-1, totalPages), limit)
+			links = append(links, `<`+response.Prev+`>; rel="prev"`)
+		}
+		if totalPages > 0 {
+			links = append(links, `<`+pageURL(c, 1, limit)+`>; rel="first"`)
+			links = append(links, `<`+pageURL(c, totalPages, limit)+`>; rel="last"`)
+		}
+	}
+	if len(links) > 0 {
+		c.Set(fiber.HeaderLink, strings.Join(links, ", "))
+	}
+
+	return c.Status(status).JSON(response)
+}
+
+// pageURL rebuilds the current request URL pointing to another page
+func pageURL(c fiber.Ctx, page, limit int) string {
+	return rewriteQuery(c, map[string]string{
+		"page":  strconv.Itoa(page),
+		"limit": strconv.Itoa(limit),
 	})
 }
+
+// cursorURL rebuilds the current request URL pointing to the rows after the cursor
+func cursorURL(c fiber.Ctx, cursor string, limit int) string {
+	return rewriteQuery(c, map[string]string{
+		"cursor": cursor,
+		"limit":  strconv.Itoa(limit),
+		"page":   "",
+	})
+}
+
+// rewriteQuery returns the current request URL with the given query params replaced,
+// params with an empty value are removed
+func rewriteQuery(c fiber.Ctx, params map[string]string) string {
+	u, err := url.Parse(c.OriginalURL())
+	if err != nil {
+		return ""
+	}
+	query := u.Query()
+	for key, value := range params {
+		if value == "" {
+			query.Del(key)
+			continue
+		}
+		query.Set(key, value)
+	}
+	u.RawQuery = query.Encode()
+	return c.BaseURL() + u.String()
+}
+
+// IsWebSocketUpgrade reports whether the request is a WebSocket handshake
+func IsWebSocketUpgrade(c fiber.Ctx) bool {
+	return strings.Contains(strings.ToLower(c.Get(fiber.HeaderConnection)), "upgrade") &&
+		strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket")
+}
+
+// IsEventStream reports whether the request asks for a Server-Sent Events stream
+func IsEventStream(c fiber.Ctx) bool {
+	return strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream")
+}
+
+// IsStreamRequest reports whether the request opens a WebSocket or an event stream. Browsers can't set
+// headers on them, so they may send the credentials and the tenant in query params instead
+func IsStreamRequest(c fiber.Ctx) bool {
+	return IsWebSocketUpgrade(c) || IsEventStream(c)
+}
@@ -0,0 +1,62 @@
+package shared
+
+const DefaultLimit = 10
+
+// NormalizePagination applies the default page and limit when they are not set
+func NormalizePagination(page, limit int) (int, int) {
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return page, limit
+}
+
+// PaginationCriteria translates a page and limit into LIMIT/OFFSET criteria,
+// when a cursor is given the rows are read with a keyset seek instead of an OFFSET.
+// The rows are always sorted by ID after the given sorts so the order is deterministic
+func PaginationCriteria(page, limit int, cursor string, sorts []Criterion) ([]Criterion, error) {
+	page, limit = NormalizePagination(page, limit)
+
+	var seek Cursor
+	if cursor != "" {
+		decoded, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if len(decoded.Values) != len(sorts) {
+			return nil, ErrInvalidCursor
+		}
+		seek = decoded
+	}
+
+	criteria := []Criterion{
+		{Field: "id", Operator: OpSeek, Value: seek},
+		{Operator: OpLimit, Value: limit},
+	}
+	if cursor == "" {
+		criteria = append(criteria, Criterion{Operator: OpOffset, Value: (page - 1) * limit})
+	}
+	return criteria, nil
+}
+
+// WithoutPagination returns the criteria without LIMIT/OFFSET/SEEK and sorting, used to count the total of items
+func WithoutPagination(criteria []Criterion) []Criterion {
+	filtered := make([]Criterion, 0, len(criteria))
+	for _, c := range criteria {
+		if c.Operator == OpLimit || c.Operator == OpOffset || c.Operator == OpSeek || c.Operator == OpSort {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
+}
+
+// TotalPages returns the number of pages needed to list totalItems
+func TotalPages(totalItems int64, limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	return int((totalItems + int64(limit) - 1) / int64(limit))
+}
@@ -0,0 +1,62 @@
+package shared
+
+import (
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	PrincipalUser   = "user"
+	PrincipalAPIKey = "api_key"
+)
+
+// Permission is an action allowed on a resource, formatted as resource:action
+type Permission string
+
+const (
+	PermProductsRead     Permission = "products:read"
+	PermProductsWrite    Permission = "products:write"
+	PermProductsDelete   Permission = "products:delete"
+	PermProductsPurge    Permission = "products:purge"
+	PermCategoriesRead   Permission = "categories:read"
+	PermCategoriesWrite  Permission = "categories:write"
+	PermCategoriesDelete Permission = "categories:delete"
+	PermCategoriesPurge  Permission = "categories:purge"
+	PermHistoryRead      Permission = "history:read"
+	PermUsersManage      Permission = "users:manage"
+	PermAPIKeysManage    Permission = "api_keys:manage"
+	PermWebhooksManage   Permission = "webhooks:manage"
+)
+
+type principalKey struct{}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID          uint
+	Type        string
+	Email       string
+	Name        string
+	Roles       []string
+	Permissions []Permission
+	// TenantID binds the principal to a tenant, nil lets it pick the tenant of each request
+	TenantID *uint
+	// TokenID is the ID of the access token used to authenticate, it allows to revoke it
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+func (p *Principal) Can(permission Permission) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+func SetPrincipal(c fiber.Ctx, principal *Principal) {
+	fiber.Locals[*Principal](c, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal set by the authentication middleware
+func PrincipalFrom(c fiber.Ctx) (*Principal, bool) {
+	principal := fiber.Locals[*Principal](c, principalKey{})
+	return principal, principal != nil
+}
@@ -0,0 +1,48 @@
+package shared
+
+import "github.com/gofiber/fiber/v3"
+
+// Route declares an endpoint and the permission required to call it, routes are public only when Public is set
+// and require just an authenticated principal when Permission is empty
+type Route struct {
+	Method     string
+	Path       string
+	Handler    fiber.Handler
+	Permission Permission
+	Public     bool
+}
+
+// RouteGuard holds the middlewares used to protect the registered routes
+type RouteGuard struct {
+	Authenticate fiber.Handler
+	Authorize    func(Permission) fiber.Handler
+	// Tenant resolves the tenant the request acts on, see RegisterTenantRoutes
+	Tenant fiber.Handler
+}
+
+func RegisterRoutes(app *fiber.App, guard RouteGuard, routes []Route) {
+	registerRoutes(app, guard, routes)
+}
+
+// RegisterTenantRoutes registers routes acting on the catalog of a tenant, the tenant is resolved once the
+// request is authorized and is available to the repositories through the request context
+func RegisterTenantRoutes(app *fiber.App, guard RouteGuard, routes []Route) {
+	registerRoutes(app, guard, routes, guard.Tenant)
+}
+
+func registerRoutes(app *fiber.App, guard RouteGuard, routes []Route, middlewares ...fiber.Handler) {
+	for _, route := range routes {
+		handlers := make([]any, 0, 3+len(middlewares))
+		if !route.Public {
+			handlers = append(handlers, guard.Authenticate)
+			if route.Permission != "" {
+				handlers = append(handlers, guard.Authorize(route.Permission))
+			}
+			for _, middleware := range middlewares {
+				handlers = append(handlers, middleware)
+			}
+		}
+		handlers = append(handlers, route.Handler)
+		app.Add([]string{route.Method}, route.Path, handlers[0], handlers[1:]...)
+	}
+}
@@ -0,0 +1,182 @@
+package shared
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm/clause"
+)
+
+type FieldType string
+
+const (
+	FieldString  FieldType = "string"
+	FieldInteger FieldType = "integer"
+	FieldNumber  FieldType = "number"
+	FieldTime    FieldType = "time"
+	FieldBool    FieldType = "bool"
+)
+
+// Field describes a column that criteria are allowed to filter or sort by
+type Field struct {
+	Column    string
+	Type      FieldType
+	Operators []Operator
+	Sortable  bool
+	// Membership makes the field filter by the rows linked through a join table instead of a column
+	Membership *Membership
+}
+
+// Membership describes a many to many link, e.g. products to categories through product_categories.
+// Links soft deleted in the join table are ignored
+type Membership struct {
+	Table      string
+	LocalKey   string
+	OwnerKey   string
+	ForeignKey string
+}
+
+// FieldBoolType is used to coerce boolean operator values like the one of OpIsNull
+var FieldBoolType = Field{Type: FieldBool}
+
+// Schema is the whitelist of fields of a model usable through criteria,
+// fields are looked up by their public name
+type Schema struct {
+	Table  string
+	Fields map[string]Field
+	// Tenanted restricts the queries built by ApplyCriteria to the tenant of the statement context
+	Tenanted bool
+}
+
+var (
+	schemas   = make(map[string]*Schema)
+	schemasMu sync.RWMutex
+)
+
+// RegisterSchema registers the schema of a model by its table name
+func RegisterSchema(schema Schema) *Schema {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	schemas[schema.Table] = &schema
+	return &schema
+}
+
+func LookupSchema(table string) (*Schema, bool) {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+	schema, ok := schemas[table]
+	return schema, ok
+}
+
+// Field returns the whitelisted field with the given public name
+func (s *Schema) Field(name string) (Field, error) {
+	field, ok := s.Fields[name]
+	if !ok {
+		return Field{}, &CriteriaError{Field: name, Err: ErrUnknownField}
+	}
+	return field, nil
+}
+
+// Column returns the table qualified column of the field, it is always quoted when building the SQL
+func (s *Schema) Column(field Field) clause.Column {
+	return clause.Column{Table: s.Table, Name: field.Column}
+}
+
+func (f Field) Allows(op Operator) bool {
+	switch op {
+	case OpSort, OpSeek:
+		return f.Sortable
+	}
+	for _, allowed := range f.Operators {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Coerce checks the value can be compared against the field and converts it to the field type
+func (f Field) Coerce(value any) (any, bool) {
+	if value == nil {
+		return nil, false
+	}
+
+	switch f.Type {
+	case FieldString:
+		s, ok := value.(string)
+		return s, ok
+	case FieldInteger:
+		return coerceInteger(value)
+	case FieldNumber:
+		return coerceNumber(value)
+	case FieldTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			return t, err == nil
+		}
+	case FieldBool:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			b, err := strconv.ParseBool(v)
+			return b, err == nil
+		}
+	}
+	return nil, false
+}
+
+func coerceInteger(value any) (any, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case float64:
+		if v != float64(int64(v)) {
+			return nil, false
+		}
+		return int64(v), true
+	}
+
+	val := reflect.ValueOf(value)
+	switch {
+	case val.CanInt():
+		return val.Int(), true
+	case val.CanUint():
+		return val.Uint(), true
+	}
+	return nil, false
+}
+
+func coerceNumber(value any) (any, bool) {
+	switch v := value.(type) {
+	case decimal.Decimal:
+		return v, true
+	case *decimal.Decimal:
+		if v == nil {
+			return nil, false
+		}
+		return *v, true
+	case json.Number:
+		d, err := decimal.NewFromString(v.String())
+		return d, err == nil
+	case string:
+		d, err := decimal.NewFromString(v)
+		return d, err == nil
+	case float32:
+		return decimal.NewFromFloat32(v), true
+	case float64:
+		return decimal.NewFromFloat(v), true
+	}
+	return coerceInteger(value)
+}
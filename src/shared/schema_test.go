@@ -0,0 +1,29 @@
+package shared
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSchemaFieldRejectsHostileNames(t *testing.T) {
+	names := []string{
+		"name; DROP TABLE items",
+		"name; DROP",
+		`"name"`,
+		`"items"."name"`,
+		"items.name",
+		"a.b",
+		"name--",
+		"Name",
+		" name",
+		"",
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			_, err := itemSchema.Field(name)
+			if !errors.Is(err, ErrUnknownField) || !IsCriteriaError(err) {
+				t.Fatalf("Field(%q) error = %v, want ErrUnknownField", name, err)
+			}
+		})
+	}
+}
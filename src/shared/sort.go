@@ -0,0 +1,44 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// ParseSort translates a sort expression like "-price,name" into OpSort criteria,
+// a leading "-" sorts descending. Only the sortable fields of the schema are accepted
+func ParseSort(sort string, schema *Schema) ([]Criterion, error) {
+	criteria := make([]Criterion, 0)
+	if strings.TrimSpace(sort) == "" {
+		return criteria, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(sort, ",") {
+		name := strings.TrimSpace(part)
+		direction := SortAsc
+		if strings.HasPrefix(name, "-") {
+			direction = SortDesc
+			name = strings.TrimPrefix(name, "-")
+		} else {
+			name = strings.TrimPrefix(name, "+")
+		}
+
+		field, ok := schema.Fields[name]
+		if !ok || !field.Sortable || seen[name] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSort, name)
+		}
+		seen[name] = true
+
+		criteria = append(criteria, Criterion{
+			Field:    name,
+			Operator: OpSort,
+			Value:    direction,
+		})
+	}
+
+	return criteria, nil
+}
@@ -0,0 +1,255 @@
+// Package sqltest opens GORM on a fake Postgres connection for the repository tests. It records
+// every statement run, with the transactions, and answers with the results set up by the test
+package sqltest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	Begin    = "BEGIN"
+	Commit   = "COMMIT"
+	Rollback = "ROLLBACK"
+)
+
+// Statement is a statement run on the fake connection, Begin, Commit and Rollback have no arguments
+type Statement struct {
+	SQL  string
+	Args []any
+}
+
+// Compares reports if the statement compares the column to the value, and only to it, e.g.
+// Compares(`"products"."tenant_id"`, int64(7)). The unsigned integers are given as int64 to the driver
+func (s Statement) Compares(column string, value any) bool {
+	comparisons := regexp.MustCompile(regexp.QuoteMeta(column)+`\s*=\s*\$(\d+)`).FindAllStringSubmatch(s.SQL, -1)
+	for _, comparison := range comparisons {
+		n, _ := strconv.Atoi(comparison[1])
+		if n > len(s.Args) || s.Args[n-1] != value {
+			return false
+		}
+	}
+	return len(comparisons) > 0
+}
+
+// Rows are the rows returned by the queries matching a fragment
+type Rows struct {
+	Columns []string
+	Values  [][]any
+}
+
+// rule answers the statements containing fragment
+type rule struct {
+	fragment     string
+	rows         *Rows
+	rowsAffected int64
+	err          error
+}
+
+// DB records the statements run on the fake connection and holds the results set up for them
+type DB struct {
+	mu         sync.Mutex
+	statements []Statement
+	rules      []rule
+}
+
+// Open returns GORM on a new fake connection along with the DB recording it
+func Open() (*gorm.DB, *DB) {
+	fake := &DB{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(fake)}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		panic(err)
+	}
+	return db, fake
+}
+
+// Return makes the queries containing fragment return the rows, instead of none
+func (db *DB) Return(fragment string, columns []string, values ...[]any) {
+	db.add(rule{fragment: fragment, rows: &Rows{Columns: columns, Values: values}})
+}
+
+// Affect makes the statements containing fragment report n affected rows, instead of one
+func (db *DB) Affect(fragment string, n int64) {
+	db.add(rule{fragment: fragment, rowsAffected: n})
+}
+
+// Fail makes the statements containing fragment fail with err
+func (db *DB) Fail(fragment string, err error) {
+	db.add(rule{fragment: fragment, err: err})
+}
+
+// Reset forgets the statements run and the results set up
+func (db *DB) Reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = nil
+	db.rules = nil
+}
+
+// Statements returns the statements run so far, in order
+func (db *DB) Statements() []Statement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Statement(nil), db.statements...)
+}
+
+// Matching returns the statements run containing fragment
+func (db *DB) Matching(fragment string) []Statement {
+	var matching []Statement
+	for _, statement := range db.Statements() {
+		if strings.Contains(statement.SQL, fragment) {
+			matching = append(matching, statement)
+		}
+	}
+	return matching
+}
+
+// Ran reports if a statement containing fragment was run
+func (db *DB) Ran(fragment string) bool {
+	return len(db.Matching(fragment)) > 0
+}
+
+func (db *DB) add(r rule) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rules = append(db.rules, r)
+}
+
+// run records the statement and returns the first rule matching it, the rules set up last win
+func (db *DB) run(query string, args []driver.NamedValue) rule {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	statement := Statement{SQL: query}
+	for _, arg := range args {
+		statement.Args = append(statement.Args, arg.Value)
+	}
+	db.statements = append(db.statements, statement)
+	for i := len(db.rules) - 1; i >= 0; i-- {
+		if strings.Contains(query, db.rules[i].fragment) {
+			return db.rules[i]
+		}
+	}
+	return rule{}
+}
+
+func (db *DB) record(query string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = append(db.statements, Statement{SQL: query})
+}
+
+// Connect implements driver.Connector
+func (db *DB) Connect(context.Context) (driver.Conn, error) {
+	return &conn{db: db}, nil
+}
+
+// Driver implements driver.Connector
+func (db *DB) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, driver.ErrSkip
+}
+
+type conn struct {
+	db *DB
+}
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.db.record(Begin)
+	return tx{db: c.db}, nil
+}
+
+// CheckNamedValue keeps the arguments the driver cannot convert as they are, so the tests can compare them
+func (c *conn) CheckNamedValue(value *driver.NamedValue) error {
+	if converted, err := driver.DefaultParameterConverter.ConvertValue(value.Value); err == nil {
+		value.Value = converted
+	}
+	return nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r := c.db.run(query, args)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.rows == nil && r.fragment != "" {
+		return driver.RowsAffected(r.rowsAffected), nil
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r := c.db.run(query, args)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.rows == nil {
+		return &rows{}, nil
+	}
+	return &rows{columns: r.rows.Columns, values: r.rows.Values}, nil
+}
+
+type tx struct {
+	db *DB
+}
+
+func (t tx) Commit() error {
+	t.db.record(Commit)
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.db.record(Rollback)
+	return nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]any
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	for i, value := range r.values[r.next] {
+		dest[i] = value
+	}
+	r.next++
+	return nil
+}
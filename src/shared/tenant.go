@@ -0,0 +1,61 @@
+package shared
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const TenantColumn = "tenant_id"
+
+var (
+	ErrTenantRequired = errors.New("tenant required")
+	ErrTenantMismatch = errors.New("row belongs to another tenant")
+)
+
+type tenantKey struct{}
+
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFrom returns the tenant the request acts on
+func TenantFrom(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	tenantID, ok := ctx.Value(tenantKey{}).(uint)
+	return tenantID, ok && tenantID != 0
+}
+
+// TenantScope restricts a query to the rows of the tenant of the statement context (see gorm.DB.WithContext),
+// the query fails with ErrTenantRequired when the context has no tenant so it never leaks other tenants rows
+func TenantScope(table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		tenantID, ok := TenantFrom(db.Statement.Context)
+		if !ok {
+			db.AddError(ErrTenantRequired)
+			return db
+		}
+		return db.Where(clause.Eq{Column: clause.Column{Table: table, Name: TenantColumn}, Value: tenantID})
+	}
+}
+
+// AssignTenant sets the tenant of a row about to be created from the statement context,
+// it is meant to be called from the BeforeCreate hooks of the tenant owned models
+func AssignTenant(tx *gorm.DB, tenantID *uint) error {
+	current, ok := TenantFrom(tx.Statement.Context)
+	if *tenantID != 0 {
+		if ok && current != *tenantID {
+			return ErrTenantMismatch
+		}
+		return nil
+	}
+	if !ok {
+		return ErrTenantRequired
+	}
+	*tenantID = current
+	return nil
+}
@@ -0,0 +1,65 @@
+package shared
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type unitOfWorkKey struct{}
+
+// unitOfWork is the transaction in progress along with the functions to run once it commits
+type unitOfWork struct {
+	tx          *gorm.DB
+	afterCommit []func()
+}
+
+// UnitOfWork runs functions in a database transaction shared through the context, so the repositories
+// called with that context write together or not at all
+type UnitOfWork struct {
+	db *gorm.DB
+}
+
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Do runs fn in a transaction committed when fn returns nil and rolled back otherwise.
+// When the context already carries a transaction fn joins it, the outermost Do commits
+func (u *UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork); ok {
+		return fn(ctx)
+	}
+
+	work := &unitOfWork{}
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		work.tx = tx
+		return fn(context.WithValue(ctx, unitOfWorkKey{}, work))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range work.afterCommit {
+		fn()
+	}
+	return nil
+}
+
+// DB returns the transaction carried by the context, or db when there is none, bound to the context
+func DB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if work, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork); ok {
+		return work.tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// AfterCommit runs fn once the transaction carried by the context commits, it is dropped on rollback.
+// Without a transaction fn runs right away
+func AfterCommit(ctx context.Context, fn func()) {
+	if work, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork); ok {
+		work.afterCommit = append(work.afterCommit, fn)
+		return
+	}
+	fn()
+}
@@ -0,0 +1,142 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Javieradel/api-qisur.git/src/shared/sqltest"
+)
+
+var errInjected = errors.New("injected failure")
+
+// transactionLog returns the statements run with the transaction boundaries
+func transactionLog(fake *sqltest.DB) []string {
+	var log []string
+	for _, statement := range fake.Statements() {
+		log = append(log, statement.SQL)
+	}
+	return log
+}
+
+// insert runs the query in the unit of work of the context
+func insert(ctx context.Context, uow *UnitOfWork, query string) error {
+	return DB(ctx, uow.db).Exec(query).Error
+}
+
+func TestUnitOfWorkCommitsThenRunsCallbacks(t *testing.T) {
+	db, fake := sqltest.Open()
+	uow := NewUnitOfWork(db)
+
+	var calls []string
+	err := uow.Do(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, func() { calls = append(calls, "first") })
+		if err := insert(ctx, uow, "INSERT INTO items VALUES (1)"); err != nil {
+			return err
+		}
+		AfterCommit(ctx, func() { calls = append(calls, "second") })
+		if len(calls) > 0 {
+			t.Fatal("callback run before the commit")
+		}
+		return insert(ctx, uow, "INSERT INTO items VALUES (2)")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{sqltest.Begin, "INSERT INTO items VALUES (1)", "INSERT INTO items VALUES (2)", sqltest.Commit}
+	if log := transactionLog(fake); !slices.Equal(log, want) {
+		t.Fatalf("statements = %q, want %q", log, want)
+	}
+	if !slices.Equal(calls, []string{"first", "second"}) {
+		t.Fatalf("callbacks = %v, want first and second", calls)
+	}
+}
+
+func TestUnitOfWorkRollsBackOnError(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(ctx context.Context, fake *sqltest.DB, uow *UnitOfWork) error
+	}{
+		{"failing statement", func(ctx context.Context, fake *sqltest.DB, uow *UnitOfWork) error {
+			fake.Fail("INSERT INTO histories", errInjected)
+			if err := insert(ctx, uow, "INSERT INTO items VALUES (1)"); err != nil {
+				return err
+			}
+			return insert(ctx, uow, "INSERT INTO histories VALUES (1)")
+		}},
+		{"error returned", func(ctx context.Context, fake *sqltest.DB, uow *UnitOfWork) error {
+			if err := insert(ctx, uow, "INSERT INTO items VALUES (1)"); err != nil {
+				return err
+			}
+			return errInjected
+		}},
+		{"nested unit of work failing", func(ctx context.Context, fake *sqltest.DB, uow *UnitOfWork) error {
+			if err := insert(ctx, uow, "INSERT INTO items VALUES (1)"); err != nil {
+				return err
+			}
+			return uow.Do(ctx, func(ctx context.Context) error {
+				AfterCommit(ctx, func() { t.Error("callback of the nested unit of work run") })
+				return errInjected
+			})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := sqltest.Open()
+			uow := NewUnitOfWork(db)
+
+			err := uow.Do(context.Background(), func(ctx context.Context) error {
+				AfterCommit(ctx, func() { t.Error("callback run after a rollback") })
+				return tt.fn(ctx, fake, uow)
+			})
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("error = %v, want the injected failure", err)
+			}
+
+			log := transactionLog(fake)
+			if len(log) < 3 || log[0] != sqltest.Begin || log[len(log)-1] != sqltest.Rollback {
+				t.Fatalf("statements = %q, want them in a transaction rolled back", log)
+			}
+			if slices.Contains(log, sqltest.Commit) || slices.Index(log[1:], sqltest.Begin) >= 0 {
+				t.Fatalf("statements = %q, want a single transaction never committed", log)
+			}
+		})
+	}
+}
+
+func TestUnitOfWorkNestedJoinsTheOuterTransaction(t *testing.T) {
+	db, fake := sqltest.Open()
+	uow := NewUnitOfWork(db)
+
+	committed := false
+	err := uow.Do(context.Background(), func(ctx context.Context) error {
+		if err := insert(ctx, uow, "INSERT INTO items VALUES (1)"); err != nil {
+			return err
+		}
+		return uow.Do(ctx, func(ctx context.Context) error {
+			AfterCommit(ctx, func() { committed = true })
+			return insert(ctx, uow, "INSERT INTO histories VALUES (1)")
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{sqltest.Begin, "INSERT INTO items VALUES (1)", "INSERT INTO histories VALUES (1)", sqltest.Commit}
+	if log := transactionLog(fake); !slices.Equal(log, want) {
+		t.Fatalf("statements = %q, want %q", log, want)
+	}
+	if !committed {
+		t.Fatal("callback of the nested unit of work not run after the commit")
+	}
+}
+
+func TestAfterCommitWithoutUnitOfWorkRunsRightAway(t *testing.T) {
+	run := false
+	AfterCommit(context.Background(), func() { run = true })
+	if !run {
+		t.Fatal("callback not run")
+	}
+}
@@ -0,0 +1,31 @@
+package suggest
+
+import "gorm.io/gorm"
+
+const (
+	TypeProduct  = "product"
+	TypeCategory = "category"
+)
+
+// Suggestion is a product or category name matching the typed text
+type Suggestion struct {
+	Type  string  `json:"type"`
+	ID    uint    `json:"id"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// Migrate enables pg_trgm and adds the trigram indexes used to match names
+func Migrate(db *gorm.DB) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON categories USING GIN (name gin_trgm_ops)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package suggest
+
+import (
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/gofiber/fiber/v3"
+)
+
+type SuggestController struct {
+	service   *SuggestService
+	validator *shared.XValidator
+}
+
+func NewSuggestController(service *SuggestService, validator *shared.XValidator) *SuggestController {
+	return &SuggestController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// Routes declares the suggest endpoints and the permission each one requires
+func (sc *SuggestController) Routes() []shared.Route {
+	return []shared.Route{
+		{Method: fiber.MethodGet, Path: "/api/v1/suggest", Handler: sc.GetSuggestions, Permission: shared.PermProductsRead},
+	}
+}
+
+func (sc *SuggestController) RegisterRoutes(app *fiber.App, guard shared.RouteGuard) {
+	shared.RegisterTenantRoutes(app, guard, sc.Routes())
+}
+
+// @Summary Suggest product and category names
+// @Description Typeahead suggestions of product and category names by trigram similarity, tolerant of typos
+// @Tags suggest
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param q query string true "Typed text"
+// @Param limit query int false "Maximum number of suggestions" default(5)
+// @Success 200 {object} shared.Response{data=[]Suggestion} "OK with suggestions"
+// @Failure 400 {object} shared.Response "Invalid query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /suggest [get]
+func (sc *SuggestController) GetSuggestions(c fiber.Ctx) error {
+	var q SuggestQueryDTO
+	if err := c.Bind().Query(&q); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalids query params")
+	}
+
+	if errs := sc.validator.Validate(q); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	suggestions, err := sc.service.Suggest(c.Context(), q.Q, q.Limit)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch suggestions")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, suggestions)
+}
@@ -0,0 +1,6 @@
+package suggest
+
+type SuggestQueryDTO struct {
+	Q     string `query:"q" validate:"required,max=100"`
+	Limit int    `query:"limit" validate:"gte=0,lte=20"`
+}
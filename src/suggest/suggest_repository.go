@@ -0,0 +1,53 @@
+package suggest
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
+)
+
+type SuggestRepository struct {
+	DB *gorm.DB
+}
+
+func NewSuggestRepository(db *gorm.DB) *SuggestRepository {
+	return &SuggestRepository{DB: db}
+}
+
+// FindProducts returns the product names most similar to q
+func (r *SuggestRepository) FindProducts(ctx context.Context, q string, limit int) ([]Suggestion, error) {
+	return r.find(ctx, "products", TypeProduct, q, limit)
+}
+
+// FindCategories returns the category names most similar to q
+func (r *SuggestRepository) FindCategories(ctx context.Context, q string, limit int) ([]Suggestion, error) {
+	return r.find(ctx, "categories", TypeCategory, q, limit)
+}
+
+// find matches the names of the tenant by trigram word similarity, tolerant of typos, or by prefix for very short inputs
+func (r *SuggestRepository) find(ctx context.Context, table, kind, q string, limit int) ([]Suggestion, error) {
+	suggestions := make([]Suggestion, 0, limit)
+	err := shared.DB(ctx, r.DB).
+		Table(table).
+		Scopes(shared.TenantScope(table)).
+		Select("id, name, word_similarity(?, name) AS score", q).
+		Where("deleted_at IS NULL").
+		Where("(? <% name OR name ILIKE ?)", q, escapeLike(q)+"%").
+		Order("score DESC, name").
+		Limit(limit).
+		Scan(&suggestions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range suggestions {
+		suggestions[i].Type = kind
+	}
+	return suggestions, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,80 @@
+package suggest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLimit   = 5
+	defaultTimeout = 150 * time.Millisecond
+)
+
+type SuggestService struct {
+	repo    *SuggestRepository
+	timeout time.Duration
+}
+
+// NewSuggestService builds the service with the latency budget set in SUGGEST_TIMEOUT_MS
+func NewSuggestService(repo *SuggestRepository) *SuggestService {
+	timeout := defaultTimeout
+	if ms, err := strconv.Atoi(os.Getenv("SUGGEST_TIMEOUT_MS")); err == nil && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	return &SuggestService{repo: repo, timeout: timeout}
+}
+
+// Suggest looks up products and categories concurrently and returns the best matches.
+// A source that does not answer within the latency budget is left out instead of failing the request
+func (s *SuggestService) Suggest(ctx context.Context, q string, limit int) ([]Suggestion, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	sources := []func(context.Context, string, int) ([]Suggestion, error){
+		s.repo.FindProducts,
+		s.repo.FindCategories,
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]Suggestion, len(sources))
+	errs := make([]error, len(sources))
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source func(context.Context, string, int) ([]Suggestion, error)) {
+			defer wg.Done()
+			results[i], errs[i] = source(ctx, q, limit)
+		}(i, source)
+	}
+	wg.Wait()
+
+	suggestions := make([]Suggestion, 0, limit*len(sources))
+	for i, err := range errs {
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("Suggestions for %q exceeded the latency budget of %s", q, s.timeout)
+				continue
+			}
+			return nil, err
+		}
+		suggestions = append(suggestions, results[i]...)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions, nil
+}
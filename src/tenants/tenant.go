@@ -0,0 +1,65 @@
+package tenants
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const DefaultSlug = "default"
+
+// Tenant owns a catalog, every product, category and history row belongs to one
+type Tenant struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string `gorm:"not null"`
+	Slug      string `gorm:"uniqueIndex;not null"`
+}
+
+func (Tenant) TableName() string {
+	return "tenants"
+}
+
+// Migrate creates the tenants table with the default tenant and adds the tenant_id column to the given tables,
+// the rows that existed before multi tenancy are assigned to the default tenant
+func Migrate(db *gorm.DB, tables ...string) (*Tenant, error) {
+	if err := db.AutoMigrate(&Tenant{}); err != nil {
+		return nil, err
+	}
+
+	tenant, err := EnsureDefault(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range tables {
+		if !db.Migrator().HasTable(table) || db.Migrator().HasColumn(table, "tenant_id") {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %q ADD COLUMN tenant_id bigint", table)).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(fmt.Sprintf("UPDATE %q SET tenant_id = ?", table), tenant.ID).Error; err != nil {
+				return err
+			}
+			return tx.Exec(fmt.Sprintf("ALTER TABLE %q ALTER COLUMN tenant_id SET NOT NULL", table)).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add tenant_id to %s: %w", table, err)
+		}
+	}
+
+	return tenant, nil
+}
+
+// EnsureDefault returns the default tenant, creating it when missing
+func EnsureDefault(db *gorm.DB) (*Tenant, error) {
+	tenant := Tenant{Name: "Default", Slug: DefaultSlug}
+	if err := db.Where(Tenant{Slug: DefaultSlug}).FirstOrCreate(&tenant).Error; err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
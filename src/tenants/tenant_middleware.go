@@ -0,0 +1,63 @@
+package tenants
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+const HeaderTenant = "X-Tenant-ID"
+
+// NewTenantMiddleware resolves the tenant of the request and stores it in the request context.
+// Principals bound to a tenant always act on it, the X-Tenant-ID header (ID or slug) selects the tenant
+// of the principals that aren't bound to one, like the platform admins. WebSocket handshakes and event streams may use the tenant query param
+func NewTenantMiddleware(repo *TenantRepository) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		principal, found := shared.PrincipalFrom(c)
+		if !found {
+			return shared.NewErrorResponse(c, fiber.StatusUnauthorized, "Unauthorized")
+		}
+
+		var requested *Tenant
+		header := c.Get(HeaderTenant)
+		if header == "" && shared.IsStreamRequest(c) {
+			header = c.Query("tenant")
+		}
+		if header != "" {
+			tenant, err := findTenant(repo, header)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Unknown tenant")
+				}
+				return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to resolve tenant")
+			}
+			requested = tenant
+		}
+
+		var tenantID uint
+		switch {
+		case principal.TenantID != nil:
+			if requested != nil && requested.ID != *principal.TenantID {
+				return shared.NewErrorResponse(c, fiber.StatusForbidden, "Forbidden: tenant not allowed")
+			}
+			tenantID = *principal.TenantID
+		case requested != nil:
+			tenantID = requested.ID
+		default:
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, HeaderTenant+" header is required")
+		}
+
+		c.SetContext(shared.WithTenant(c.Context(), tenantID))
+		return c.Next()
+	}
+}
+
+func findTenant(repo *TenantRepository, value string) (*Tenant, error) {
+	if id, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return repo.FindByID(uint(id))
+	}
+	return repo.FindBySlug(value)
+}
@@ -0,0 +1,27 @@
+package tenants
+
+import "gorm.io/gorm"
+
+type TenantRepository struct {
+	DB *gorm.DB
+}
+
+func NewTenantRepository(db *gorm.DB) *TenantRepository {
+	return &TenantRepository{DB: db}
+}
+
+func (r *TenantRepository) FindByID(id uint) (*Tenant, error) {
+	var tenant Tenant
+	if err := r.DB.First(&tenant, id).Error; err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (r *TenantRepository) FindBySlug(slug string) (*Tenant, error) {
+	var tenant Tenant
+	if err := r.DB.Where("slug = ?", slug).First(&tenant).Error; err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
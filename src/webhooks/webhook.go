@@ -0,0 +1,107 @@
+package webhooks
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SecretPrefix marks the signing secrets generated by the API
+const SecretPrefix = "whsec_"
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Topics are the event topics of a webhook stored as a JSON array
+type Topics []string
+
+func (t Topics) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+func (t *Topics) Scan(value any) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	case nil:
+		*t = nil
+		return nil
+	}
+	return errors.New("unsupported topics value")
+}
+
+func (Topics) GormDataType() string {
+	return "jsonb"
+}
+
+// Webhook subscribes a partner URL to the events of a tenant, the secret signs every delivery
+type Webhook struct {
+	ID          uint           `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	TenantID    uint           `gorm:"index;not null" json:"tenant_id"`
+	URL         string         `gorm:"not null" json:"url"`
+	Topics      Topics         `gorm:"type:jsonb;not null" json:"topics"`
+	Secret      string         `gorm:"not null" json:"-"`
+	Active      bool           `gorm:"not null;default:true" json:"active"`
+	CreatedByID *uint          `json:"created_by_id"`
+}
+
+func (w *Webhook) BeforeCreate(tx *gorm.DB) error {
+	return shared.AssignTenant(tx, &w.TenantID)
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// WebhookDelivery is an event sent to a webhook, it records the outcome of the last attempt
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	TenantID  uint      `gorm:"index;not null" json:"tenant_id"`
+	WebhookID uint      `gorm:"index;not null;uniqueIndex:idx_webhook_deliveries_event,where:redelivery_of_id IS NULL" json:"webhook_id"`
+	// EventID is shared by the deliveries of the same event so partners can discard duplicates,
+	// an event is queued once per webhook besides the redeliveries
+	EventID uuid.UUID `gorm:"type:uuid;index;not null;uniqueIndex:idx_webhook_deliveries_event,where:redelivery_of_id IS NULL" json:"event_id"`
+	Topic   string    `gorm:"not null" json:"topic"`
+	// Body is the JSON sent to the webhook, kept so retries and redeliveries send the same content
+	Body           string     `gorm:"type:jsonb;not null" json:"body"`
+	Status         string     `gorm:"index;not null" json:"status"`
+	Attempts       int        `gorm:"not null" json:"attempts"`
+	NextAttemptAt  *time.Time `gorm:"index" json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	ResponseCode   *int       `json:"response_code"`
+	ResponseBody   string     `json:"response_body"`
+	Error          string     `json:"error"`
+	RedeliveryOfID *uint      `json:"redelivery_of_id"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// DeliveryBody is the JSON posted to the webhooks
+type DeliveryBody struct {
+	ID         uuid.UUID `json:"id"`
+	Topic      string    `json:"topic"`
+	TenantID   uint      `json:"tenant_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
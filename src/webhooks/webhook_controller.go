@@ -0,0 +1,283 @@
+package webhooks
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type WebhookController struct {
+	service   *WebhookService
+	validator *shared.XValidator
+}
+
+func NewWebhookController(service *WebhookService, validator *shared.XValidator) *WebhookController {
+	return &WebhookController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// Routes declares the webhook endpoints and the permission each one requires
+func (wc *WebhookController) Routes() []shared.Route {
+	return []shared.Route{
+		{Method: fiber.MethodGet, Path: "/api/v1/webhooks", Handler: wc.GetWebhooks, Permission: shared.PermWebhooksManage},
+		{Method: fiber.MethodPost, Path: "/api/v1/webhooks", Handler: wc.CreateWebhook, Permission: shared.PermWebhooksManage},
+		{Method: fiber.MethodGet, Path: "/api/v1/webhooks/:id", Handler: wc.GetWebhook, Permission: shared.PermWebhooksManage},
+		{Method: fiber.MethodPatch, Path: "/api/v1/webhooks/:id", Handler: wc.UpdateWebhook, Permission: shared.PermWebhooksManage},
+		{Method: fiber.MethodDelete, Path: "/api/v1/webhooks/:id", Handler: wc.DeleteWebhook, Permission: shared.PermWebhooksManage},
+		{Method: fiber.MethodGet, Path: "/api/v1/webhooks/:id/deliveries", Handler: wc.GetDeliveries, Permission: shared.PermWebhooksManage},
+		{Method: fiber.MethodPost, Path: "/api/v1/webhooks/:id/deliveries/:deliveryId/redeliver", Handler: wc.Redeliver, Permission: shared.PermWebhooksManage},
+	}
+}
+
+func (wc *WebhookController) RegisterRoutes(app *fiber.App, guard shared.RouteGuard) {
+	shared.RegisterTenantRoutes(app, guard, wc.Routes())
+}
+
+// @Summary Get webhooks
+// @Description Get the webhooks of the tenant, the secrets are never returned
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} shared.Response{data=[]Webhook} "OK with webhooks"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /webhooks [get]
+func (wc *WebhookController) GetWebhooks(c fiber.Ctx) error {
+	webhooks, err := wc.service.FindAll(c.Context())
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch webhooks")
+	}
+	return shared.NewSuccessResponse(c, fiber.StatusOK, webhooks)
+}
+
+// @Summary Get a webhook
+// @Description Get a webhook of the tenant by ID
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} shared.Response{data=Webhook} "OK with webhook"
+// @Failure 400 {object} shared.Response "Invalid webhook ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Webhook not found"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /webhooks/{id} [get]
+func (wc *WebhookController) GetWebhook(c fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	webhook, err := wc.service.FindByID(c.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Webhook not found")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch webhook")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, webhook)
+}
+
+// @Summary Create a webhook
+// @Description Subscribe a URL to event topics like product.updated. Every delivery is signed with the secret, which is only returned once. The URL must use https, plain http only in development, and resolve to public addresses
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param webhook body CreateWebhookDTO true "Webhook data"
+// @Success 201 {object} shared.Response{data=IssuedWebhookDTO} "Webhook created successfully"
+// @Failure 400 {object} shared.Response "Invalid request body, URL or topic"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /webhooks [post]
+func (wc *WebhookController) CreateWebhook(c fiber.Ctx) error {
+	var dto CreateWebhookDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if errs := wc.validator.Validate(dto); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	principal, _ := shared.PrincipalFrom(c)
+	webhook, err := wc.service.Create(c.Context(), &dto, principal)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTopic) || errors.Is(err, ErrInvalidURL) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to create webhook")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusCreated, webhook)
+}
+
+// @Summary Update a webhook
+// @Description Change the URL or the topics of a webhook, or pause it with active false
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param webhook body UpdateWebhookDTO true "Webhook fields to update"
+// @Success 200 {object} shared.Response{data=Webhook} "Webhook updated successfully"
+// @Failure 400 {object} shared.Response "Invalid webhook ID, request body, URL or topic"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Webhook not found"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /webhooks/{id} [patch]
+func (wc *WebhookController) UpdateWebhook(c fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	var dto UpdateWebhookDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if errs := wc.validator.Validate(dto); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	webhook, err := wc.service.Update(c.Context(), uint(id), &dto)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Webhook not found")
+		}
+		if errors.Is(err, ErrInvalidTopic) || errors.Is(err, ErrInvalidURL) {
+			return shared.NewErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to update webhook")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, webhook)
+}
+
+// @Summary Delete a webhook
+// @Description Delete a webhook, its pending deliveries are given up
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} shared.Response "Webhook deleted successfully"
+// @Failure 400 {object} shared.Response "Invalid webhook ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Webhook not found"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /webhooks/{id} [delete]
+func (wc *WebhookController) DeleteWebhook(c fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	if err := wc.service.Delete(c.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Webhook not found")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete webhook")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, "Webhook deleted successfully")
+}
+
+// @Summary Get webhook deliveries
+// @Description Get the latest deliveries of a webhook with their status, attempts and last response
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param status query string false "Delivery status" Enums(pending, succeeded, failed)
+// @Param limit query int false "Maximum number of deliveries" default(50)
+// @Success 200 {object} shared.Response{data=[]WebhookDelivery} "OK with deliveries"
+// @Failure 400 {object} shared.Response "Invalid webhook ID or query parameters"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Webhook not found"
+// @Failure 422 {object} shared.Response "Validation failed"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /webhooks/{id}/deliveries [get]
+func (wc *WebhookController) GetDeliveries(c fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	var q DeliveryQueryDTO
+	if err := c.Bind().Query(&q); err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalids query params")
+	}
+
+	if errs := wc.validator.Validate(q); len(errs) > 0 {
+		return shared.NewValidationErrorResponse(c, errs)
+	}
+
+	deliveries, err := wc.service.FindDeliveries(c.Context(), uint(id), q.Status, q.Limit)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Webhook not found")
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch deliveries")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusOK, deliveries)
+}
+
+// @Summary Redeliver a webhook delivery
+// @Description Queue a new delivery with the same body and event ID as a finished one
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param deliveryId path int true "Delivery ID"
+// @Success 202 {object} shared.Response{data=WebhookDelivery} "Redelivery queued"
+// @Failure 400 {object} shared.Response "Invalid webhook or delivery ID"
+// @Failure 401 {object} shared.Response "Unauthorized"
+// @Failure 403 {object} shared.Response "Forbidden"
+// @Failure 404 {object} shared.Response "Webhook or delivery not found"
+// @Failure 409 {object} shared.Response "Delivery still pending"
+// @Failure 500 {object} shared.Response "Internal server error"
+// @Router /webhooks/{id}/deliveries/{deliveryId}/redeliver [post]
+func (wc *WebhookController) Redeliver(c fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook ID")
+	}
+	deliveryID, err := strconv.ParseUint(c.Params("deliveryId"), 10, 32)
+	if err != nil {
+		return shared.NewErrorResponse(c, fiber.StatusBadRequest, "Invalid delivery ID")
+	}
+
+	delivery, err := wc.service.Redeliver(c.Context(), uint(id), uint(deliveryID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return shared.NewErrorResponse(c, fiber.StatusNotFound, "Webhook or delivery not found")
+		}
+		if errors.Is(err, ErrDeliveryInProgress) {
+			return shared.NewErrorResponse(c, fiber.StatusConflict, err.Error())
+		}
+		return shared.NewErrorResponse(c, fiber.StatusInternalServerError, "Failed to redeliver")
+	}
+
+	return shared.NewSuccessResponse(c, fiber.StatusAccepted, delivery)
+}
@@ -0,0 +1,202 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Event-ID"
+	HeaderDelivery  = "X-Webhook-Delivery"
+
+	// MaxAttempts is the number of attempts before a delivery is given up
+	MaxAttempts = 10
+
+	retryBase       = 30 * time.Second
+	retryMax        = 6 * time.Hour
+	requestTimeout  = 10 * time.Second
+	pollInterval    = 5 * time.Second
+	claimLease      = time.Minute
+	claimBatch      = 20
+	maxResponseBody = 1024
+)
+
+// Dispatcher sends the pending deliveries, retrying the failed ones with an exponential backoff
+type Dispatcher struct {
+	repo   *WebhookRepository
+	client *http.Client
+	wake   chan struct{}
+	now    func() time.Time
+}
+
+func NewDispatcher(repo *WebhookRepository) *Dispatcher {
+	return &Dispatcher{
+		repo: repo,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// the partners are reached directly, never through a proxy, and only on public addresses
+			Transport: &http.Transport{
+				DialContext:         (&net.Dialer{Timeout: requestTimeout, Control: refuseNonPublic}).DialContext,
+				TLSHandshakeTimeout: requestTimeout,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// a redirect is reported as a failure instead of posting the event to another URL
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		wake: make(chan struct{}, 1),
+		now:  time.Now,
+	}
+}
+
+// Start sends the due deliveries in the background, when woken up and every poll interval for the retries
+func (d *Dispatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			d.dispatchDue()
+			select {
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// Wake makes the dispatcher look for due deliveries without waiting for the next poll
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) dispatchDue() {
+	for {
+		deliveries, err := d.repo.ClaimDue(d.now(), claimLease, claimBatch)
+		if err != nil {
+			log.Printf("Error claiming webhook deliveries: %v", err)
+			return
+		}
+
+		for i := range deliveries {
+			d.deliver(&deliveries[i])
+		}
+
+		if len(deliveries) < claimBatch {
+			return
+		}
+	}
+}
+
+// deliver makes an attempt and schedules the next one when it fails
+func (d *Dispatcher) deliver(delivery *WebhookDelivery) {
+	webhook, err := d.repo.FindWebhook(delivery.WebhookID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		webhook = nil
+	case err != nil:
+		log.Printf("Error loading webhook %d: %v", delivery.WebhookID, err)
+		return
+	}
+
+	now := d.now()
+	if webhook == nil || webhook.DeletedAt.Valid || !webhook.Active {
+		delivery.Status = DeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.Error = "webhook disabled"
+	} else {
+		delivery.Attempts++
+		delivery.LastAttemptAt = &now
+		delivery.ResponseCode, delivery.ResponseBody, err = d.send(webhook, delivery, now)
+		switch {
+		case err == nil:
+			delivery.Status = DeliverySucceeded
+			delivery.NextAttemptAt = nil
+			delivery.Error = ""
+		case delivery.Attempts >= MaxAttempts:
+			delivery.Status = DeliveryFailed
+			delivery.NextAttemptAt = nil
+			delivery.Error = err.Error()
+		default:
+			next := now.Add(Backoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+			delivery.Error = err.Error()
+		}
+	}
+
+	if err := d.repo.SaveAttempt(delivery); err != nil {
+		log.Printf("Error saving webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send posts the body signed with the webhook secret, any status but 2xx is an error
+func (d *Dispatcher) send(webhook *Webhook, delivery *WebhookDelivery, now time.Time) (*int, string, error) {
+	body := []byte(delivery.Body)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "api-qisur-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Topic)
+	req.Header.Set(HeaderEventID, delivery.EventID.String())
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(webhook.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	// the response is only kept for troubleshooting, it is cut and cleaned so any text column accepts it
+	raw, _ := io.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	response := strings.ReplaceAll(strings.ToValidUTF8(string(raw), ""), "\x00", "")
+	code := res.StatusCode
+	if code < 200 || code > 299 {
+		return &code, response, errors.New(res.Status)
+	}
+	return &code, response, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" with the secret, the timestamp
+// is signed so a captured delivery can't be replayed later
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is the delay before the next attempt, doubling from 30 seconds up to 6 hours
+func Backoff(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMax {
+			return retryMax
+		}
+	}
+	return delay
+}
@@ -0,0 +1,275 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/Javieradel/api-qisur.git/src/shared/sqltest"
+	"github.com/google/uuid"
+)
+
+const (
+	testSecret = "whsec_test"
+	testBody   = `{"id":"2f0c7f5e-8a55-4bd6-9a53-3c1f9c1f2a10","topic":"product.created","tenant_id":7,"data":{"id":1}}`
+)
+
+var (
+	testEventID = uuid.MustParse("2f0c7f5e-8a55-4bd6-9a53-3c1f9c1f2a10")
+	testNow     = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// partner is a webhook endpoint answering with the given status and recording the requests it receives
+type partner struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newPartner(t *testing.T, status int) *partner {
+	p := &partner{status: status}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		p.mu.Lock()
+		p.requests = append(p.requests, receivedRequest{header: r.Header.Clone(), body: body})
+		status := p.status
+		p.mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *partner) received() []receivedRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]receivedRequest(nil), p.requests...)
+}
+
+// newTestDispatcher returns a dispatcher finding an active webhook of tenant 7 posting to the partner
+func newTestDispatcher(p *partner) (*Dispatcher, *sqltest.DB) {
+	db, fake := sqltest.Open()
+	fake.Return(`FROM "webhooks"`,
+		[]string{"id", "tenant_id", "url", "topics", "secret", "active"},
+		[]any{int64(1), int64(7), p.URL, `["product.created"]`, testSecret, true},
+	)
+	dispatcher := NewDispatcher(NewWebhookRepository(db))
+	dispatcher.now = func() time.Time { return testNow }
+	// the partner listens on the loopback, which the dispatcher refuses to reach
+	dispatcher.client.Transport = &http.Transport{}
+	return dispatcher, fake
+}
+
+func pendingDelivery() *WebhookDelivery {
+	return &WebhookDelivery{
+		ID:        3,
+		TenantID:  7,
+		WebhookID: 1,
+		EventID:   testEventID,
+		Topic:     "product.created",
+		Body:      testBody,
+		Status:    DeliveryPending,
+	}
+}
+
+func TestDispatcherSignsDeliveries(t *testing.T) {
+	p := newPartner(t, http.StatusNoContent)
+	dispatcher, fake := newTestDispatcher(p)
+
+	delivery := pendingDelivery()
+	dispatcher.deliver(delivery)
+
+	requests := p.received()
+	if len(requests) != 1 {
+		t.Fatalf("received %d requests, want 1", len(requests))
+	}
+	header, body := requests[0].header, requests[0].body
+	if string(body) != testBody {
+		t.Errorf("body = %s, want %s", body, testBody)
+	}
+
+	timestamp := strconv.FormatInt(testNow.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(timestamp + "." + testBody))
+	want := map[string]string{
+		HeaderSignature: "sha256=" + hex.EncodeToString(mac.Sum(nil)),
+		HeaderTimestamp: timestamp,
+		HeaderEvent:     "product.created",
+		HeaderEventID:   testEventID.String(),
+		HeaderDelivery:  "3",
+		"Content-Type":  "application/json",
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	if delivery.Status != DeliverySucceeded || delivery.Attempts != 1 || delivery.NextAttemptAt != nil {
+		t.Errorf("delivery = %s after %d attempts, next at %v, want succeeded after 1", delivery.Status, delivery.Attempts, delivery.NextAttemptAt)
+	}
+	if delivery.ResponseCode == nil || *delivery.ResponseCode != http.StatusNoContent {
+		t.Errorf("response code = %v, want %d", delivery.ResponseCode, http.StatusNoContent)
+	}
+	if !fake.Ran(`UPDATE "webhook_deliveries"`) {
+		t.Error("attempt not saved")
+	}
+}
+
+func TestDispatcherRefusesNonPublicAddresses(t *testing.T) {
+	p := newPartner(t, http.StatusNoContent)
+	dispatcher, _ := newTestDispatcher(p)
+	dispatcher.client.Transport = NewDispatcher(dispatcher.repo).client.Transport
+
+	delivery := pendingDelivery()
+	dispatcher.deliver(delivery)
+
+	if len(p.received()) != 0 {
+		t.Fatal("delivered to the loopback")
+	}
+	if delivery.Status != DeliveryPending || delivery.ResponseCode != nil || !strings.Contains(delivery.Error, "not a public address") {
+		t.Fatalf("delivery = %s, response %v, error %q, want a pending delivery refused", delivery.Status, delivery.ResponseCode, delivery.Error)
+	}
+}
+
+func TestSignIsVerifiedByPartners(t *testing.T) {
+	signature := Sign(testSecret, "1700000000", []byte(testBody))
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte("1700000000." + testBody))
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		t.Fatalf("signature %s does not match the HMAC-SHA256 of <timestamp>.<body>", signature)
+	}
+	if Sign("another secret", "1700000000", []byte(testBody)) == signature {
+		t.Fatal("the signature does not depend on the secret")
+	}
+	if Sign(testSecret, "1700000001", []byte(testBody)) == signature {
+		t.Fatal("the signature does not depend on the timestamp")
+	}
+}
+
+func TestDispatcherRetriesFailedDeliveriesWithBackoff(t *testing.T) {
+	p := newPartner(t, http.StatusInternalServerError)
+	dispatcher, _ := newTestDispatcher(p)
+
+	delivery := pendingDelivery()
+	for attempt, wait := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute} {
+		dispatcher.deliver(delivery)
+
+		if delivery.Status != DeliveryPending || delivery.Attempts != attempt+1 {
+			t.Fatalf("delivery = %s after %d attempts, want pending after %d", delivery.Status, delivery.Attempts, attempt+1)
+		}
+		if delivery.NextAttemptAt == nil || !delivery.NextAttemptAt.Equal(testNow.Add(wait)) {
+			t.Fatalf("attempt %d: next attempt at %v, want %v", attempt+1, delivery.NextAttemptAt, testNow.Add(wait))
+		}
+		if delivery.ResponseCode == nil || *delivery.ResponseCode != http.StatusInternalServerError || delivery.Error == "" {
+			t.Fatalf("attempt %d: response %v, error %q", attempt+1, delivery.ResponseCode, delivery.Error)
+		}
+	}
+	if len(p.received()) != 3 {
+		t.Fatalf("received %d requests, want 3", len(p.received()))
+	}
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	p := newPartner(t, http.StatusServiceUnavailable)
+	dispatcher, fake := newTestDispatcher(p)
+
+	delivery := pendingDelivery()
+	delivery.Attempts = MaxAttempts - 1
+	dispatcher.deliver(delivery)
+
+	if delivery.Status != DeliveryFailed || delivery.Attempts != MaxAttempts || delivery.NextAttemptAt != nil {
+		t.Fatalf("delivery = %s after %d attempts, next at %v, want failed after %d", delivery.Status, delivery.Attempts, delivery.NextAttemptAt, MaxAttempts)
+	}
+	saved := fake.Matching(`UPDATE "webhook_deliveries"`)
+	if len(saved) != 1 || !saved[0].Compares(`"status"`, DeliveryFailed) {
+		t.Fatalf("saved %v, want the failed status", saved)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{10, 4*time.Hour + 16*time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRedeliverSendsTheSameEventAgain(t *testing.T) {
+	p := newPartner(t, http.StatusOK)
+	dispatcher, fake := newTestDispatcher(p)
+	fake.Return(`FROM "webhook_deliveries"`,
+		[]string{"id", "tenant_id", "webhook_id", "event_id", "topic", "body", "status", "attempts"},
+		[]any{int64(3), int64(7), int64(1), testEventID.String(), "product.created", testBody, DeliveryFailed, int64(MaxAttempts)},
+	)
+	fake.Return(`INSERT INTO "webhook_deliveries"`, []string{"id"}, []any{int64(4)})
+	service := NewWebhookService(dispatcher.repo, dispatcher)
+	service.now = func() time.Time { return testNow }
+
+	redelivery, err := service.Redeliver(shared.WithTenant(context.Background(), 7), 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivery.ID != 4 || redelivery.RedeliveryOfID == nil || *redelivery.RedeliveryOfID != 3 || redelivery.Status != DeliveryPending {
+		t.Fatalf("redelivery = %+v, want a pending delivery 4 of delivery 3", redelivery)
+	}
+
+	dispatcher.deliver(redelivery)
+
+	requests := p.received()
+	if len(requests) != 1 {
+		t.Fatalf("received %d requests, want 1", len(requests))
+	}
+	header := requests[0].header
+	if string(requests[0].body) != testBody || header.Get(HeaderEventID) != testEventID.String() || header.Get(HeaderDelivery) != "4" {
+		t.Fatalf("redelivered %s with event %s as delivery %s", requests[0].body, header.Get(HeaderEventID), header.Get(HeaderDelivery))
+	}
+	if redelivery.Status != DeliverySucceeded || redelivery.Attempts != 1 {
+		t.Fatalf("redelivery = %s after %d attempts, want succeeded after 1", redelivery.Status, redelivery.Attempts)
+	}
+}
+
+func TestRedeliverRefusesPendingDeliveries(t *testing.T) {
+	p := newPartner(t, http.StatusOK)
+	dispatcher, fake := newTestDispatcher(p)
+	fake.Return(`FROM "webhook_deliveries"`,
+		[]string{"id", "tenant_id", "webhook_id", "event_id", "topic", "body", "status"},
+		[]any{int64(3), int64(7), int64(1), testEventID.String(), "product.created", testBody, DeliveryPending},
+	)
+
+	_, err := NewWebhookService(dispatcher.repo, dispatcher).Redeliver(shared.WithTenant(context.Background(), 7), 1, 3)
+	if err != ErrDeliveryInProgress {
+		t.Fatalf("error = %v, want ErrDeliveryInProgress", err)
+	}
+	if fake.Ran("INSERT") {
+		t.Fatal("a pending delivery was queued again")
+	}
+}
@@ -0,0 +1,25 @@
+package webhooks
+
+type CreateWebhookDTO struct {
+	URL    string   `json:"url" validate:"required,http_url"`
+	Topics []string `json:"topics" validate:"required,min=1"`
+	// Secret signs the deliveries, a random one is generated when empty
+	Secret string `json:"secret" validate:"omitempty,min=16"`
+}
+
+type UpdateWebhookDTO struct {
+	URL    *string  `json:"url,omitempty" validate:"omitempty,http_url"`
+	Topics []string `json:"topics,omitempty" validate:"omitempty,min=1"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+type DeliveryQueryDTO struct {
+	Status string `query:"status" validate:"omitempty,oneof=pending succeeded failed"`
+	Limit  int    `query:"limit" validate:"gte=0,lte=100"`
+}
+
+// IssuedWebhookDTO is returned once when a webhook is created, the secret can't be read again
+type IssuedWebhookDTO struct {
+	Webhook
+	Secret string `json:"secret"`
+}
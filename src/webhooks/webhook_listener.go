@@ -0,0 +1,39 @@
+package webhooks
+
+import (
+	"fmt"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+)
+
+// WebhookListener queues the deliveries of the catalog events to the subscribed webhooks
+type WebhookListener struct {
+	service *WebhookService
+}
+
+func NewWebhookListener(service *WebhookService) *WebhookListener {
+	return &WebhookListener{service: service}
+}
+
+func (*WebhookListener) ListenerName() string {
+	return "webhooks"
+}
+
+// Listen subscribes the listener to every topic a webhook can subscribe to
+func (l *WebhookListener) Listen(bus *shared.EventBus) {
+	for topic := range shared.EventTopics {
+		bus.Subscribe(topic, l)
+	}
+}
+
+func (l *WebhookListener) Handle(event shared.Event) error {
+	tenantEvent, ok := event.(shared.TenantEvent)
+	if !ok {
+		return nil
+	}
+
+	if err := l.service.Enqueue(tenantEvent); err != nil {
+		return fmt.Errorf("queueing webhook deliveries of %s: %w", event.Topic(), err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository struct {
+	DB *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{DB: db}
+}
+
+// db returns the connection bound to the context, which carries the tenant the queries are scoped to
+// and the transaction of the unit of work in progress, if any
+func (r *WebhookRepository) db(ctx context.Context) *gorm.DB {
+	return shared.DB(ctx, r.DB)
+}
+
+func (r *WebhookRepository) FindAll(ctx context.Context) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := r.db(ctx).Scopes(shared.TenantScope("webhooks")).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *WebhookRepository) FindByID(ctx context.Context, id uint) (*Webhook, error) {
+	var webhook Webhook
+	if err := r.db(ctx).Scopes(shared.TenantScope("webhooks")).First(&webhook, id).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// FindSubscribed returns the active webhooks of the tenant in the context subscribed to the topic
+func (r *WebhookRepository) FindSubscribed(ctx context.Context, topic string) ([]Webhook, error) {
+	subscribed, err := Topics{topic}.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []Webhook
+	err = r.db(ctx).
+		Scopes(shared.TenantScope("webhooks")).
+		Where("active AND topics @> ?", subscribed).
+		Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, webhook *Webhook) error {
+	return r.db(ctx).Create(webhook).Error
+}
+
+// Update saves the editable fields of the webhook, a webhook of another tenant is not found
+func (r *WebhookRepository) Update(ctx context.Context, webhook *Webhook) error {
+	result := r.db(ctx).Model(webhook).Scopes(shared.TenantScope("webhooks")).Select("url", "topics", "active").Updates(webhook)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, id uint) error {
+	return r.db(ctx).Scopes(shared.TenantScope("webhooks")).Delete(&Webhook{}, id).Error
+}
+
+// CreateDeliveries queues the deliveries, the ones of an event already queued to the webhook are skipped
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	return r.db(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+}
+
+// FindDeliveries returns the latest deliveries of a webhook, optionally only the ones in the given status
+func (r *WebhookRepository) FindDeliveries(ctx context.Context, webhookID uint, status string, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	query := r.db(ctx).
+		Scopes(shared.TenantScope("webhook_deliveries")).
+		Where("webhook_id = ?", webhookID).
+		Order("id DESC").
+		Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *WebhookRepository) FindDelivery(ctx context.Context, webhookID, id uint) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := r.db(ctx).
+		Scopes(shared.TenantScope("webhook_deliveries")).
+		Where("webhook_id = ?", webhookID).
+		First(&delivery, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ClaimDue locks the pending deliveries due at now and pushes their next attempt after the lease,
+// so other instances skip them while they are sent. It works across tenants for the dispatcher
+func (r *WebhookRepository) ClaimDue(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(deliveries))
+		for i, delivery := range deliveries {
+			ids[i] = delivery.ID
+		}
+		return tx.Model(&WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return deliveries, err
+}
+
+// FindWebhook returns a webhook of any tenant, including the deleted ones, for the dispatcher
+func (r *WebhookRepository) FindWebhook(id uint) (*Webhook, error) {
+	var webhook Webhook
+	if err := r.DB.Unscoped().First(&webhook, id).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// SaveAttempt records the outcome of a delivery attempt
+func (r *WebhookRepository) SaveAttempt(delivery *WebhookDelivery) error {
+	return r.DB.Model(delivery).
+		Select("status", "attempts", "next_attempt_at", "last_attempt_at", "response_code", "response_body", "error").
+		Updates(delivery).Error
+}
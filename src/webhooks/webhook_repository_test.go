@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/Javieradel/api-qisur.git/src/shared/sqltest"
+	"gorm.io/gorm"
+)
+
+const tenantA uint = 7
+
+// webhookOfTenantB is the ID of a webhook owned by another tenant, the fake database finds no row for it
+// when the queries are restricted to tenant A
+const webhookOfTenantB uint = 42
+
+var repositoryCalls = []struct {
+	name  string
+	table string
+	run   func(ctx context.Context, repo *WebhookRepository, id uint) error
+}{
+	{"FindAll", "webhooks", func(ctx context.Context, repo *WebhookRepository, _ uint) error {
+		_, err := repo.FindAll(ctx)
+		return err
+	}},
+	{"FindByID", "webhooks", func(ctx context.Context, repo *WebhookRepository, id uint) error {
+		_, err := repo.FindByID(ctx, id)
+		return err
+	}},
+	{"FindSubscribed", "webhooks", func(ctx context.Context, repo *WebhookRepository, _ uint) error {
+		_, err := repo.FindSubscribed(ctx, "product.created")
+		return err
+	}},
+	{"Update", "webhooks", func(ctx context.Context, repo *WebhookRepository, id uint) error {
+		return repo.Update(ctx, &Webhook{ID: id, URL: "https://attacker.example", Active: true})
+	}},
+	{"Delete", "webhooks", func(ctx context.Context, repo *WebhookRepository, id uint) error {
+		return repo.Delete(ctx, id)
+	}},
+	{"FindDeliveries", "webhook_deliveries", func(ctx context.Context, repo *WebhookRepository, id uint) error {
+		_, err := repo.FindDeliveries(ctx, id, "", 10)
+		return err
+	}},
+	{"FindDelivery", "webhook_deliveries", func(ctx context.Context, repo *WebhookRepository, id uint) error {
+		_, err := repo.FindDelivery(ctx, id, 1)
+		return err
+	}},
+}
+
+// tableStatements returns the statements reading or writing the table
+func tableStatements(fake *sqltest.DB, table string) []sqltest.Statement {
+	var statements []sqltest.Statement
+	for _, statement := range fake.Statements() {
+		if strings.Contains(statement.SQL, `FROM "`+table+`"`) || strings.Contains(statement.SQL, `UPDATE "`+table+`"`) {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+func TestWebhookRepositoryIsolatesTenants(t *testing.T) {
+	for _, call := range repositoryCalls {
+		t.Run(call.name, func(t *testing.T) {
+			db, fake := sqltest.Open()
+			fake.Affect(`UPDATE "webhooks"`, 0)
+			err := call.run(shared.WithTenant(context.Background(), tenantA), NewWebhookRepository(db), webhookOfTenantB)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatal(err)
+			}
+
+			statements := tableStatements(fake, call.table)
+			if len(statements) == 0 {
+				t.Fatalf("no statement on %s", call.table)
+			}
+			for _, statement := range statements {
+				if !statement.Compares(`"`+call.table+`"."tenant_id"`, int64(tenantA)) {
+					t.Errorf("not restricted to tenant A: %s %v", statement.SQL, statement.Args)
+				}
+			}
+			if fake.Ran("INSERT") || fake.Ran("DELETE") {
+				t.Errorf("the webhook of another tenant was written: %v", fake.Statements())
+			}
+		})
+	}
+}
+
+func TestWebhookRepositoryUpdateOfAnotherTenantIsNotFound(t *testing.T) {
+	db, fake := sqltest.Open()
+	fake.Affect(`UPDATE "webhooks"`, 0)
+
+	webhook := &Webhook{ID: webhookOfTenantB, URL: "https://attacker.example", Active: true}
+	err := NewWebhookRepository(db).Update(shared.WithTenant(context.Background(), tenantA), webhook)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("error = %v, want gorm.ErrRecordNotFound", err)
+	}
+}
+
+func TestWebhookRepositoryRequiresTenant(t *testing.T) {
+	for _, call := range repositoryCalls {
+		t.Run(call.name, func(t *testing.T) {
+			db, fake := sqltest.Open()
+			err := call.run(context.Background(), NewWebhookRepository(db), 1)
+			if !errors.Is(err, shared.ErrTenantRequired) {
+				t.Fatalf("error = %v, want shared.ErrTenantRequired", err)
+			}
+			if statements := tableStatements(fake, call.table); len(statements) > 0 {
+				t.Fatalf("ran without a tenant: %v", fake.Statements())
+			}
+		})
+	}
+}
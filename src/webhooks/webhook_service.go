@@ -0,0 +1,213 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Javieradel/api-qisur.git/src/shared"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	secretBytes            = 24
+)
+
+var (
+	ErrInvalidTopic       = errors.New("invalid topic")
+	ErrDeliveryInProgress = errors.New("delivery is still pending")
+)
+
+type WebhookService struct {
+	repo       *WebhookRepository
+	dispatcher *Dispatcher
+	now        func() time.Time
+	// httpsOnly rejects the plain http URLs, it is off in development only
+	httpsOnly bool
+}
+
+func NewWebhookService(repo *WebhookRepository, dispatcher *Dispatcher) *WebhookService {
+	return &WebhookService{repo: repo, dispatcher: dispatcher, now: time.Now, httpsOnly: requireHTTPS()}
+}
+
+func (s *WebhookService) FindAll(ctx context.Context) ([]Webhook, error) {
+	return s.repo.FindAll(ctx)
+}
+
+func (s *WebhookService) FindByID(ctx context.Context, id uint) (*Webhook, error) {
+	return s.repo.FindByID(ctx, id)
+}
+
+// Create subscribes the URL to the topics, the returned secret is the only time it is available
+func (s *WebhookService) Create(ctx context.Context, dto *CreateWebhookDTO, creator *shared.Principal) (*IssuedWebhookDTO, error) {
+	if err := validateURL(ctx, dto.URL, s.httpsOnly); err != nil {
+		return nil, err
+	}
+	topics, err := validTopics(dto.Topics)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := dto.Secret
+	if secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	webhook := &Webhook{URL: dto.URL, Topics: topics, Secret: secret, Active: true}
+	if creator.Type == shared.PrincipalUser {
+		webhook.CreatedByID = &creator.ID
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	return &IssuedWebhookDTO{Webhook: *webhook, Secret: secret}, nil
+}
+
+func (s *WebhookService) Update(ctx context.Context, id uint, dto *UpdateWebhookDTO) (*Webhook, error) {
+	webhook, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if dto.URL != nil {
+		if err := validateURL(ctx, *dto.URL, s.httpsOnly); err != nil {
+			return nil, err
+		}
+		webhook.URL = *dto.URL
+	}
+	if dto.Topics != nil {
+		if webhook.Topics, err = validTopics(dto.Topics); err != nil {
+			return nil, err
+		}
+	}
+	if dto.Active != nil {
+		webhook.Active = *dto.Active
+	}
+
+	if err := s.repo.Update(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) Delete(ctx context.Context, id uint) error {
+	if _, err := s.repo.FindByID(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *WebhookService) FindDeliveries(ctx context.Context, webhookID uint, status string, limit int) ([]WebhookDelivery, error) {
+	if _, err := s.repo.FindByID(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultDeliveriesLimit
+	}
+	return s.repo.FindDeliveries(ctx, webhookID, status, limit)
+}
+
+// Redeliver queues a new delivery with the same body as a finished one, the original is kept in the log
+func (s *WebhookService) Redeliver(ctx context.Context, webhookID, deliveryID uint) (*WebhookDelivery, error) {
+	if _, err := s.repo.FindByID(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	original, err := s.repo.FindDelivery(ctx, webhookID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if original.Status == DeliveryPending {
+		return nil, ErrDeliveryInProgress
+	}
+
+	now := s.now()
+	deliveries := []WebhookDelivery{{
+		TenantID:       original.TenantID,
+		WebhookID:      original.WebhookID,
+		EventID:        original.EventID,
+		Topic:          original.Topic,
+		Body:           original.Body,
+		Status:         DeliveryPending,
+		NextAttemptAt:  &now,
+		RedeliveryOfID: &original.ID,
+	}}
+	if err := s.repo.CreateDeliveries(ctx, deliveries); err != nil {
+		return nil, err
+	}
+	s.dispatcher.Wake()
+	return &deliveries[0], nil
+}
+
+// Enqueue queues a delivery of the event for every webhook of its tenant subscribed to the topic
+func (s *WebhookService) Enqueue(event shared.TenantEvent) error {
+	ctx := shared.WithTenant(context.Background(), event.Tenant())
+	webhooks, err := s.repo.FindSubscribed(ctx, event.Topic())
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	var data any = event
+	if payload, ok := event.(shared.PayloadEvent); ok {
+		data = payload.Payload()
+	}
+	now := s.now()
+	eventID, occurredAt := uuid.New(), now
+	if identified, ok := event.(shared.IdentifiedEvent); ok {
+		eventID, occurredAt = identified.EventID(), identified.EventTime()
+	}
+	body, err := json.Marshal(DeliveryBody{
+		ID:         eventID,
+		Topic:      event.Topic(),
+		TenantID:   event.Tenant(),
+		OccurredAt: occurredAt,
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]WebhookDelivery, len(webhooks))
+	for i, webhook := range webhooks {
+		deliveries[i] = WebhookDelivery{
+			TenantID:      webhook.TenantID,
+			WebhookID:     webhook.ID,
+			EventID:       eventID,
+			Topic:         event.Topic(),
+			Body:          string(body),
+			Status:        DeliveryPending,
+			NextAttemptAt: &now,
+		}
+	}
+	if err := s.repo.CreateDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	s.dispatcher.Wake()
+	return nil
+}
+
+func validTopics(topics []string) (Topics, error) {
+	valid := make(Topics, 0, len(topics))
+	for _, topic := range topics {
+		if _, found := shared.EventTopics[topic]; !found {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTopic, topic)
+		}
+		valid = append(valid, topic)
+	}
+	return valid, nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
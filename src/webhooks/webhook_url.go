@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+)
+
+var ErrInvalidURL = errors.New("invalid webhook URL")
+
+// nonPublicPrefixes are the ranges not covered by the netip predicates that must not be reached either:
+// shared address space (cloud metadata services like 100.100.100.200 live there), IETF protocol
+// assignments, benchmarking, reserved and the IPv6 ranges embedding them
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// requireHTTPS reports if the webhooks must use https, plain http is only accepted when APP_ENV is development
+func requireHTTPS() bool {
+	return !strings.EqualFold(os.Getenv("APP_ENV"), "development")
+}
+
+// isPublic reports if the address is reachable on the internet, the webhooks can't target the
+// loopback, the private networks, the link-local addresses (169.254.169.254) or the like
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateURL checks that the webhook URL is absolute, uses https when required and only resolves to public addresses
+func validateURL(ctx context.Context, raw string, httpsOnly bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && !httpsOnly:
+	default:
+		return fmt.Errorf("%w: https is required", ErrInvalidURL)
+	}
+
+	// an IP address is returned as is, without a DNS lookup
+	host := u.Hostname()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: %s can't be resolved", ErrInvalidURL, host)
+	}
+	for _, addr := range addrs {
+		if !isPublic(addr) {
+			return fmt.Errorf("%w: %s is not a public address", ErrInvalidURL, host)
+		}
+	}
+	return nil
+}
+
+// refuseNonPublic is the dialer control refusing to connect to addresses that are not public. It runs on the
+// address actually dialed, so a host resolving to a public address when registered and to a private one
+// later (DNS rebinding) is refused too
+func refuseNonPublic(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s is not a public address", ErrInvalidURL, addrPort.Addr())
+	}
+	return nil
+}
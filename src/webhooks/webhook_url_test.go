@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateURLRejectsNonPublicHosts(t *testing.T) {
+	urls := []string{
+		"https://127.0.0.1/hook",
+		"https://localhost:8080/hook",
+		"https://10.0.0.5/hook",
+		"https://172.16.3.4/hook",
+		"https://192.168.1.1/hook",
+		"https://169.254.169.254/latest/meta-data/",
+		"https://100.100.100.200/latest/meta-data/",
+		"https://0.0.0.0/hook",
+		"https://[::1]/hook",
+		"https://[fd00:ec2::254]/hook",
+		"https://[fe80::1]/hook",
+		"https://[::ffff:127.0.0.1]/hook",
+		"https://224.0.0.1/hook",
+	}
+	for _, url := range urls {
+		t.Run(url, func(t *testing.T) {
+			if err := validateURL(context.Background(), url, false); !errors.Is(err, ErrInvalidURL) {
+				t.Fatalf("error = %v, want ErrInvalidURL", err)
+			}
+		})
+	}
+}
+
+func TestValidateURLRequiresHTTPSOutsideDevelopment(t *testing.T) {
+	tests := []struct {
+		url       string
+		httpsOnly bool
+		valid     bool
+	}{
+		{"https://93.184.215.14/hook", true, true},
+		{"http://93.184.215.14/hook", true, false},
+		{"http://93.184.215.14/hook", false, true},
+		{"https://[2606:4700::1111]/hook", true, true},
+		{"ftp://93.184.215.14/hook", false, false},
+		{"/hook", false, false},
+	}
+	for _, tt := range tests {
+		err := validateURL(context.Background(), tt.url, tt.httpsOnly)
+		if tt.valid && err != nil {
+			t.Errorf("%s (https only %t): %v", tt.url, tt.httpsOnly, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("%s (https only %t): error = %v, want ErrInvalidURL", tt.url, tt.httpsOnly, err)
+		}
+	}
+}